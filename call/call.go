@@ -1,19 +1,35 @@
 package call
 
-import "lineblocs.com/api/model"
+import (
+	"time"
+
+	"lineblocs.com/api/model"
+)
 
 /*
 Interface of Call Store.
 Implementation of Call Store is located /store/call
 */
 type Store interface {
-	CreateCall(*model.Call) (string, error)
-	UpdateCall(*model.CallUpdate) error
+	CreateCall(*model.Call, *int, time.Duration) (string, error)
+	CountActiveCalls(int, time.Duration) (int, error)
+	UpdateCall(*model.CallUpdate, time.Time) error
 	GetCallFromDB(int) (*model.Call, error)
+	GetCallEvents(int) ([]*model.CallEvent, error)
+	ListCalls(*model.CallFilter) (*model.CallList, error)
+	ExportCalls(*model.CallFilter, func(*model.Call, float64) error) error
+	GetCallLegTree(int) (*model.CallLegTree, error)
+	ListLiveCalls(*model.LiveCallFilter, time.Duration) ([]*model.LiveCall, error)
+	CreateCallCommand(*model.CallCommand) (*model.CallCommand, error)
+	GetPendingCallCommands(string) ([]*model.CallCommand, error)
+	AcknowledgeCallCommand(int, string) (bool, error)
 	SetSIPCallID(string, string) error
 	SetProviderByIP(string, string) error
-	CreateConference(*model.Conference) (string, error)
-	CheckIsMakingOutboundCallFirstTime(call model.Call)
+	CheckIsMakingOutboundCallFirstTime(*model.CalledCountry) (*model.CalledCountry, bool, error)
+	GetCalledCountry(int, string) (*model.CalledCountry, error)
+	GetCalledCountries(int) ([]*model.CalledCountry, error)
+	ApproveCalledCountry(int, string) error
+	SendNewDestinationEmail(*model.Workspace, *model.CalledCountry) error
 	GetWorkspaceFromDB(int) (*model.Workspace, error)
 	GetWorkspaceByDomain(string) (*model.Workspace, error)
 	GetUserFromDB(id int) (*model.User, error)
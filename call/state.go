@@ -0,0 +1,81 @@
+package call
+
+import (
+	"fmt"
+
+	"lineblocs.com/api/utils"
+)
+
+// Call statuses reported by media servers
+const (
+	StatusInitiated    = "initiated"
+	StatusRinging      = "ringing"
+	StatusAnswered     = "answered"
+	StatusOnHold       = "on-hold"
+	StatusTransferring = "transferring"
+	StatusEnded        = "ended"
+	StatusFailed       = "failed"
+	StatusBusy         = "busy"
+	StatusNoAnswer     = "no-answer"
+)
+
+// Legal transitions of the call state machine, terminal statuses have none
+var transitions = map[string][]string{
+	StatusInitiated:    {StatusRinging, StatusAnswered, StatusEnded, StatusFailed, StatusBusy, StatusNoAnswer},
+	StatusRinging:      {StatusAnswered, StatusEnded, StatusFailed, StatusBusy, StatusNoAnswer},
+	StatusAnswered:     {StatusOnHold, StatusTransferring, StatusEnded, StatusFailed},
+	StatusOnHold:       {StatusAnswered, StatusTransferring, StatusEnded, StatusFailed},
+	StatusTransferring: {StatusAnswered, StatusOnHold, StatusEnded, StatusFailed},
+	StatusEnded:        {},
+	StatusFailed:       {},
+	StatusBusy:         {},
+	StatusNoAnswer:     {},
+}
+
+/*
+Input: status
+Todo : Check the status is part of the call state machine
+Output: true if the status is known
+*/
+func IsKnownStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+/*
+Input: status
+Todo : Check the call is over once it reaches the status
+Output: true if the status is terminal
+*/
+func IsTerminal(status string) bool {
+	next, ok := transitions[status]
+	return ok && len(next) == 0
+}
+
+/*
+Todo : Get the statuses of calls that are still in progress
+Output: list of statuses
+*/
+func ActiveStatuses() []string {
+	return []string{StatusInitiated, StatusRinging, StatusAnswered, StatusOnHold, StatusTransferring}
+}
+
+/*
+Input: current status, next status
+Todo : Check a call may move from its current status to the next one, calls created before the state machine have no status and count as initiated
+Output: If legal return nil, if the next status is unknown return ErrUnknownCallStatus, else return ErrInvalidCallTransition
+*/
+func ValidateTransition(from string, to string) error {
+	if !IsKnownStatus(to) {
+		return fmt.Errorf("%w: %s", utils.ErrUnknownCallStatus, to)
+	}
+	if from == "" {
+		from = StatusInitiated
+	}
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", utils.ErrInvalidCallTransition, from, to)
+}
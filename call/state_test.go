@@ -0,0 +1,54 @@
+package call
+
+import (
+	"errors"
+	"testing"
+
+	"lineblocs.com/api/utils"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr error
+	}{
+		{StatusInitiated, StatusRinging, nil},
+		{StatusRinging, StatusAnswered, nil},
+		{StatusAnswered, StatusOnHold, nil},
+		{StatusOnHold, StatusAnswered, nil},
+		{StatusTransferring, StatusEnded, nil},
+		{"", StatusRinging, nil},
+		{"", StatusOnHold, utils.ErrInvalidCallTransition},
+		{StatusRinging, StatusOnHold, utils.ErrInvalidCallTransition},
+		{StatusAnswered, StatusRinging, utils.ErrInvalidCallTransition},
+		{StatusEnded, StatusAnswered, utils.ErrInvalidCallTransition},
+		{StatusBusy, StatusEnded, utils.ErrInvalidCallTransition},
+		{StatusAnswered, StatusAnswered, utils.ErrInvalidCallTransition},
+		{StatusAnswered, "hungup", utils.ErrUnknownCallStatus},
+		{StatusAnswered, "", utils.ErrUnknownCallStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if err := ValidateTransition(tt.from, tt.to); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	for _, status := range ActiveStatuses() {
+		if IsTerminal(status) {
+			t.Errorf("active status %s is terminal", status)
+		}
+	}
+	for _, status := range []string{StatusEnded, StatusFailed, StatusBusy, StatusNoAnswer} {
+		if !IsTerminal(status) {
+			t.Errorf("status %s is not terminal", status)
+		}
+	}
+	if IsTerminal("unknown") {
+		t.Error("unknown status is terminal")
+	}
+}
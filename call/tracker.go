@@ -0,0 +1,100 @@
+package call
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Tracker keeps the calls in progress that were created by this API instance.
+Calls are added by call creation and removed when a terminal status is reported,
+calls that are not seen again within the TTL are dropped in case their terminal event was lost.
+The calls table is what enforces concurrent call limits across instances, the tracker only rejects a call early
+when this instance alone already holds the workspace's limit
+*/
+type Tracker struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	calls map[int]map[string]time.Time
+}
+
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{
+		ttl:   ttl,
+		calls: make(map[int]map[string]time.Time),
+	}
+}
+
+/*
+Input: workspace id, call api id, concurrent call limit (nil is unlimited)
+Todo : Start tracking a call if the workspace is below its limit
+Output: true if the call was added
+*/
+func (t *Tracker) TryAdd(workspaceId int, apiId string, limit *int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reconcile(workspaceId)
+	if limit != nil && len(t.calls[workspaceId]) >= *limit {
+		return false
+	}
+	if t.calls[workspaceId] == nil {
+		t.calls[workspaceId] = make(map[string]time.Time)
+	}
+	t.calls[workspaceId][apiId] = time.Now()
+	return true
+}
+
+/*
+Input: workspace id, call api id
+Todo : Refresh a tracked call so it is not dropped as stale
+*/
+func (t *Tracker) Touch(workspaceId int, apiId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.calls[workspaceId][apiId]; ok {
+		t.calls[workspaceId][apiId] = time.Now()
+	}
+}
+
+/*
+Input: workspace id, call api id
+Todo : Stop tracking a call
+*/
+func (t *Tracker) Remove(workspaceId int, apiId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.calls[workspaceId], apiId)
+	if len(t.calls[workspaceId]) == 0 {
+		delete(t.calls, workspaceId)
+	}
+}
+
+/*
+Input: workspace id, call api id
+Todo : Check a call is tracked by this instance
+Output: true if the call is tracked and not stale
+*/
+func (t *Tracker) Has(workspaceId int, apiId string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen, ok := t.calls[workspaceId][apiId]
+	return ok && seen.After(time.Now().Add(-t.ttl))
+}
+
+// Time after which calls that are not updated are considered stale
+func (t *Tracker) TTL() time.Duration {
+	return t.ttl
+}
+
+// Drop calls of the workspace not seen within the TTL, the lock must be held
+func (t *Tracker) reconcile(workspaceId int) {
+	expired := time.Now().Add(-t.ttl)
+	for apiId, seen := range t.calls[workspaceId] {
+		if seen.Before(expired) {
+			delete(t.calls[workspaceId], apiId)
+		}
+	}
+	if len(t.calls[workspaceId]) == 0 {
+		delete(t.calls, workspaceId)
+	}
+}
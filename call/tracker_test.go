@@ -0,0 +1,94 @@
+package call
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestTrackerTryAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit *int
+		calls int
+		want  []bool
+	}{
+		{"unlimited", nil, 3, []bool{true, true, true}},
+		{"up to the limit", intPtr(2), 3, []bool{true, true, false}},
+		{"zero limit", intPtr(0), 1, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(time.Minute)
+			for i := 0; i < tt.calls; i++ {
+				if got := tracker.TryAdd(1, fmt.Sprintf("call-%d", i), tt.limit); got != tt.want[i] {
+					t.Errorf("call %d added = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrackerTryAddPerWorkspace(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	if !tracker.TryAdd(1, "a", intPtr(1)) {
+		t.Fatal("first call of workspace 1 was rejected")
+	}
+	if !tracker.TryAdd(2, "b", intPtr(1)) {
+		t.Error("workspace 2 was limited by the calls of workspace 1")
+	}
+	if tracker.TryAdd(1, "c", intPtr(1)) {
+		t.Error("workspace 1 went over its limit")
+	}
+}
+
+func TestTrackerTryAddAfterRemove(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	tracker.TryAdd(1, "a", intPtr(1))
+	tracker.Remove(1, "a")
+	if tracker.Has(1, "a") {
+		t.Error("removed call is still tracked")
+	}
+	if !tracker.TryAdd(1, "b", intPtr(1)) {
+		t.Error("removed call still counts towards the limit")
+	}
+}
+
+func TestTrackerTryAddDropsStaleCalls(t *testing.T) {
+	tracker := NewTracker(time.Millisecond)
+	tracker.TryAdd(1, "a", intPtr(1))
+	time.Sleep(5 * time.Millisecond)
+	if tracker.Has(1, "a") {
+		t.Error("stale call is still tracked")
+	}
+	if !tracker.TryAdd(1, "b", intPtr(1)) {
+		t.Error("stale call still counts towards the limit")
+	}
+}
+
+func TestTrackerTryAddConcurrent(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if tracker.TryAdd(1, fmt.Sprintf("call-%d", i), intPtr(10)) {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if added != 10 {
+		t.Errorf("added %d calls, want 10", added)
+	}
+}
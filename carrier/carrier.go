@@ -1,13 +1,17 @@
 package carrier
 
-import "lineblocs.com/api/helpers"
+import (
+	"lineblocs.com/api/helpers"
+	"lineblocs.com/api/model"
+)
 
 /*
 Interface of Carrier Store.
 Implementation of Carrier Store is located /store/carrier
 */
 type Store interface {
-	CreateSIPReport(string, string) error
+	CreateSIPReport(*model.SIPReport) error
+	GetCarrierStats(*model.CarrierStatsFilter) ([]*model.CarrierStats, error)
 	CreateRoutingFlow(*string, *string, *string) (*helpers.Flow, error)
 	StartProcessingFlow(*helpers.Flow, map[string]string) ([]*helpers.RoutablePSTNProvider, error)
 }
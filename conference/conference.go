@@ -0,0 +1,181 @@
+package conference
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Interface of Conference Store.
+Implementation of Conference Store is located /store/conference
+*/
+type Store interface {
+	CreateConference(*model.Conference) (string, error)
+	GetConference(string) (*model.Conference, error)
+	UpdateConferenceSettings(*model.Conference) error
+	CountLiveParticipants(int) (int, error)
+	JoinConference(string, string, string, *int, time.Time) (*model.ConferenceParticipant, error)
+	LeaveConference(string, string, time.Time) (*model.ConferenceParticipant, error)
+	LeaveAllConferences(string, time.Time) error
+	UpdateParticipantRole(string, string, string) (*model.ConferenceParticipant, error)
+	GetLiveParticipants(string) ([]*model.ConferenceParticipant, error)
+	GetSessions(string, int) ([]*model.ConferenceSession, error)
+	GetSessionParticipants(int) ([]*model.ConferenceParticipant, error)
+}
+
+// Participant roles
+const (
+	RoleModerator  = "moderator"
+	RoleAttendee   = "attendee"
+	RoleMuted      = "muted"
+	RoleListenOnly = "listen_only"
+)
+
+/*
+Input: role
+Todo : Check the role is one a participant can have
+Output: true when known
+*/
+func IsKnownRole(role string) bool {
+	switch role {
+	case RoleModerator, RoleAttendee, RoleMuted, RoleListenOnly:
+		return true
+	}
+	return false
+}
+
+// PINs are entered on a keypad
+const (
+	MinPinLength = 4
+	MaxPinLength = 12
+)
+
+/*
+Input: pin
+Todo : Check the PIN can be entered on a keypad
+Output: If valid return nil else return err
+*/
+func ValidatePin(pin string) error {
+	if len(pin) < MinPinLength || len(pin) > MaxPinLength {
+		return fmt.Errorf("pin must have %d to %d digits", MinPinLength, MaxPinLength)
+	}
+	if utils.NormalizeDialNumber(pin) != pin {
+		return fmt.Errorf("pin must only contain digits")
+	}
+	return nil
+}
+
+/*
+Input: Conference model
+Todo : Replace the PINs set on the conference with their bcrypt hashes, an empty PIN keeps the stored hash unless its
+clear flag is set. A new PIN may not match the other PIN, sent with it or stored, as Admit would give both the moderator role
+Output: If success return nil else return err
+*/
+func HashPins(conference *model.Conference) error {
+	if conference.ClearModeratorPin && conference.ModeratorPin != "" {
+		return errors.New("moderator_pin and clear_moderator_pin cannot both be set")
+	}
+	if conference.ClearAttendeePin && conference.AttendeePin != "" {
+		return errors.New("attendee_pin and clear_attendee_pin cannot both be set")
+	}
+	if conference.ClearModeratorPin {
+		conference.ModeratorPinHash = ""
+	}
+	if conference.ClearAttendeePin {
+		conference.AttendeePinHash = ""
+	}
+	conference.ClearModeratorPin = false
+	conference.ClearAttendeePin = false
+
+	moderatorPin, attendeePin := conference.ModeratorPin, conference.AttendeePin
+	switch {
+	case moderatorPin != "" && moderatorPin == attendeePin,
+		moderatorPin != "" && attendeePin == "" && checkPin(conference.AttendeePinHash, moderatorPin),
+		attendeePin != "" && moderatorPin == "" && checkPin(conference.ModeratorPinHash, attendeePin):
+		return errors.New("moderator and attendee pins must differ")
+	}
+
+	for _, pin := range []struct {
+		value *string
+		hash  *string
+	}{
+		{&conference.ModeratorPin, &conference.ModeratorPinHash},
+		{&conference.AttendeePin, &conference.AttendeePinHash},
+	} {
+		if *pin.value == "" {
+			continue
+		}
+		if err := ValidatePin(*pin.value); err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(*pin.value), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		*pin.hash = string(hash)
+		*pin.value = ""
+	}
+	conference.HasModeratorPin = conference.ModeratorPinHash != ""
+	conference.HasAttendeePin = conference.AttendeePinHash != ""
+	return nil
+}
+
+func checkPin(hash string, pin string) bool {
+	return hash != "" && pin != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(pin)) == nil
+}
+
+/*
+Input: Plan model, Conference model
+Todo : Get the participant cap of a conference, the lower of the plan limit and the conference's own limit
+Output: participant limit, nil when unlimited
+*/
+func ParticipantLimit(plan *model.Plan, conference *model.Conference) *int {
+	limit := plan.ConferenceLimit
+	if conference.MaxParticipants != nil && (limit == nil || *conference.MaxParticipants < *limit) {
+		limit = conference.MaxParticipants
+	}
+	return limit
+}
+
+/*
+Input: Conference model, participant limit, live participant count, pin, time of the attempt
+Todo : Decide whether a caller may enter the conference and with which role. The moderator PIN gives the moderator role,
+the attendee PIN or no PIN at all when the conference has no attendee PIN gives the attendee role
+Output: ConferenceAdmission model
+*/
+func Admit(conference *model.Conference, limit *int, participants int, pin string, at time.Time) *model.ConferenceAdmission {
+	admission := &model.ConferenceAdmission{Participants: participants, Limit: limit}
+	if conference.StartsAt != nil && at.Before(*conference.StartsAt) {
+		admission.Reason = "conference has not started yet"
+		return admission
+	}
+	if conference.EndsAt != nil && !at.Before(*conference.EndsAt) {
+		admission.Reason = "conference has ended"
+		return admission
+	}
+
+	switch {
+	case checkPin(conference.ModeratorPinHash, pin):
+		admission.Role = RoleModerator
+	case checkPin(conference.AttendeePinHash, pin):
+		admission.Role = RoleAttendee
+	case conference.AttendeePinHash == "" && pin == "":
+		admission.Role = RoleAttendee
+	default:
+		admission.Reason = "invalid pin"
+		return admission
+	}
+
+	if !utils.WithinPlanLimit(limit, participants+1) {
+		admission.Role = ""
+		admission.Reason = "conference is full"
+		return admission
+	}
+	admission.Allowed = true
+	return admission
+}
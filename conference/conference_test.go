@@ -0,0 +1,154 @@
+package conference
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"lineblocs.com/api/model"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func hashPin(t *testing.T, pin string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestAdmit(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	moderatorHash := hashPin(t, "1111")
+	attendeeHash := hashPin(t, "2222")
+	open := &model.Conference{}
+	pins := &model.Conference{ModeratorPinHash: moderatorHash, AttendeePinHash: attendeeHash}
+	moderatorOnly := &model.Conference{ModeratorPinHash: moderatorHash}
+	scheduled := &model.Conference{StartsAt: timePtr(now.Add(time.Hour)), EndsAt: timePtr(now.Add(2 * time.Hour))}
+	ended := &model.Conference{StartsAt: timePtr(now.Add(-2 * time.Hour)), EndsAt: timePtr(now)}
+
+	tests := []struct {
+		name         string
+		conference   *model.Conference
+		limit        *int
+		participants int
+		pin          string
+		wantAllowed  bool
+		wantRole     string
+		wantReason   string
+	}{
+		{"open conference", open, nil, 3, "", true, RoleAttendee, ""},
+		{"moderator pin", pins, nil, 0, "1111", true, RoleModerator, ""},
+		{"attendee pin", pins, nil, 0, "2222", true, RoleAttendee, ""},
+		{"wrong pin", pins, nil, 0, "3333", false, "", "invalid pin"},
+		{"missing attendee pin", pins, nil, 0, "", false, "", "invalid pin"},
+		{"no attendee pin needed", moderatorOnly, nil, 0, "", true, RoleAttendee, ""},
+		{"moderator of open attendee access", moderatorOnly, nil, 0, "1111", true, RoleModerator, ""},
+		{"last seat", open, intPtr(5), 4, "", true, RoleAttendee, ""},
+		{"full", open, intPtr(5), 5, "", false, "", "conference is full"},
+		{"full for moderators too", pins, intPtr(1), 1, "1111", false, "", "conference is full"},
+		{"not started", scheduled, nil, 0, "", false, "", "conference has not started yet"},
+		{"ended", ended, nil, 0, "", false, "", "conference has ended"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admission := Admit(tt.conference, tt.limit, tt.participants, tt.pin, now)
+			if admission.Allowed != tt.wantAllowed || admission.Role != tt.wantRole || admission.Reason != tt.wantReason {
+				t.Errorf("got allowed=%v role=%q reason=%q, want allowed=%v role=%q reason=%q",
+					admission.Allowed, admission.Role, admission.Reason, tt.wantAllowed, tt.wantRole, tt.wantReason)
+			}
+			if admission.Participants != tt.participants || admission.Limit != tt.limit {
+				t.Errorf("admission reports %d participants and limit %v", admission.Participants, admission.Limit)
+			}
+		})
+	}
+}
+
+func TestHashPins(t *testing.T) {
+	moderatorHash := hashPin(t, "1111")
+	tests := []struct {
+		name             string
+		conference       model.Conference
+		wantErr          bool
+		wantModeratorPin string
+		wantHasModerator bool
+		wantHasAttendee  bool
+	}{
+		{"both pins", model.Conference{ModeratorPin: "1111", AttendeePin: "2222"}, false, "1111", true, true},
+		{"same pins", model.Conference{ModeratorPin: "1111", AttendeePin: "1111"}, true, "", false, false},
+		{"attendee pin matches stored moderator pin", model.Conference{ModeratorPinHash: moderatorHash, AttendeePin: "1111"}, true, "", false, false},
+		{"attendee pin next to stored moderator pin", model.Conference{ModeratorPinHash: moderatorHash, AttendeePin: "2222"}, false, "1111", true, true},
+		{"moderator pin replaced", model.Conference{ModeratorPinHash: moderatorHash, ModeratorPin: "3333"}, false, "3333", true, false},
+		{"pin and clear flag", model.Conference{ModeratorPin: "1111", ClearModeratorPin: true}, true, "", false, false},
+		{"clear stored pin", model.Conference{ModeratorPinHash: moderatorHash, ClearModeratorPin: true}, false, "", false, false},
+		{"too short", model.Conference{AttendeePin: "12"}, true, "", false, false},
+		{"not digits", model.Conference{AttendeePin: "12ab"}, true, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conference := tt.conference
+			err := HashPins(&conference)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if conference.ModeratorPin != "" || conference.AttendeePin != "" {
+				t.Error("clear pins were kept")
+			}
+			if conference.ClearModeratorPin || conference.ClearAttendeePin {
+				t.Error("clear flags were kept")
+			}
+			if conference.HasModeratorPin != tt.wantHasModerator || conference.HasAttendeePin != tt.wantHasAttendee {
+				t.Errorf("has pins = %v/%v, want %v/%v", conference.HasModeratorPin, conference.HasAttendeePin, tt.wantHasModerator, tt.wantHasAttendee)
+			}
+			if tt.wantModeratorPin != "" && !checkPin(conference.ModeratorPinHash, tt.wantModeratorPin) {
+				t.Errorf("moderator pin hash does not match %s", tt.wantModeratorPin)
+			}
+		})
+	}
+}
+
+func TestParticipantLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		plan       *int
+		conference *int
+		want       *int
+	}{
+		{"unlimited", nil, nil, nil},
+		{"plan only", intPtr(10), nil, intPtr(10)},
+		{"conference only", nil, intPtr(5), intPtr(5)},
+		{"conference below plan", intPtr(10), intPtr(5), intPtr(5)},
+		{"conference above plan", intPtr(10), intPtr(50), intPtr(10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParticipantLimit(&model.Plan{ConferenceLimit: tt.plan}, &model.Conference{MaxParticipants: tt.conference})
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsKnownRole(t *testing.T) {
+	for _, role := range []string{RoleModerator, RoleAttendee, RoleMuted, RoleListenOnly} {
+		if !IsKnownRole(role) {
+			t.Errorf("role %s is not known", role)
+		}
+	}
+	for _, role := range []string{"", "admin", "Moderator"} {
+		if IsKnownRole(role) {
+			t.Errorf("role %q is known", role)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package debit
 
 import (
+	"time"
+
 	"lineblocs.com/api/model"
 )
 
@@ -9,6 +11,10 @@ Interface of Debit Store.
 Implementation of Debit Store is located /store/debit
 */
 type Store interface {
-	CreateDebit(*model.CallRate, *model.Debit) error
-	CreateAPIUsageDebit(*model.Workspace, *model.DebitAPI) error
+	CreateDebit(*model.CallRate, *model.Debit) (int64, error)
+	GetWorkspaceBalance(*model.Workspace) (float64, error)
+	GetUsageSummary(*model.Workspace, time.Time, time.Time) ([]*model.UsageSummaryLine, error)
+	GetDailySpend(*model.Workspace, time.Time) (float64, error)
+	ClaimBillingAlert(*model.Workspace, string, string) (bool, error)
+	ReleaseBillingAlert(*model.Workspace, string, string) error
 }
@@ -9,4 +9,6 @@ Implementation of Fax Store is located /store/fax
 type Store interface {
 	GetFaxCount(int) (*int, error)
 	CreateFax(*model.Fax, string, int64, string, string) (int64, error)
+	GetFaxFromDB(int) (*model.Fax, error)
+	GetFaxByAPIId(string) (*model.Fax, error)
 }
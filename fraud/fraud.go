@@ -0,0 +1,174 @@
+package fraud
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Interface of Fraud Store.
+Implementation of Fraud Store is located /store/fraud
+*/
+type Store interface {
+	GetRules(int) ([]*model.FraudRule, error)
+	GetActivity(*model.FraudCheck) (*model.FraudActivity, error)
+	LogDecision(*model.FraudDecision) error
+	GetDecisions(int, int) ([]*model.FraudDecision, error)
+	SuspendWorkspace(int, string) (bool, error)
+	GetSuspension(int) (*model.WorkspaceSuspension, error)
+	LiftSuspension(int) (bool, error)
+}
+
+// Rule types
+const (
+	RuleWorkspaceVelocity = "calls_per_minute"
+	RuleExtensionVelocity = "extension_calls_per_minute"
+	RuleSpendVelocity     = "spend_per_hour"
+	RulePremiumPrefix     = "premium_prefix"
+	RuleUnusualHours      = "unusual_hours"
+	RuleNewCountryBurst   = "new_country_burst"
+)
+
+// Rule actions, ordered from least to most severe
+const (
+	ActionAllow = "allow"
+	ActionScore = "score"
+	ActionAlert = "alert"
+	ActionBlock = "block"
+)
+
+var severity = map[string]int{
+	ActionAllow: 0,
+	ActionScore: 1,
+	ActionAlert: 2,
+	ActionBlock: 3,
+}
+
+// Workspaces are suspended once a single call scores this much, unless FRAUD_SUSPEND_SCORE is set
+const DefaultSuspendScore = 100
+
+/*
+Todo : Get the rules used when neither the workspace nor the global fraud_rules configure any
+Output: list of FraudRule model
+*/
+func DefaultRules() []*model.FraudRule {
+	return []*model.FraudRule{
+		{Type: RuleWorkspaceVelocity, Action: ActionAlert, Threshold: 30, Score: 40},
+		{Type: RuleExtensionVelocity, Action: ActionAlert, Threshold: 10, Score: 40},
+		{Type: RuleSpendVelocity, Action: ActionAlert, Threshold: 5000, Score: 50},
+		{Type: RulePremiumPrefix, Action: ActionAlert, Score: 60,
+			Prefixes: []string{"1900", "1976", "4487", "4490", "4491", "4498", "881", "882", "883"}},
+		{Type: RuleUnusualHours, Action: ActionScore, Score: 20, StartHour: 0, EndHour: 6, Timezone: "UTC"},
+		{Type: RuleNewCountryBurst, Action: ActionAlert, Threshold: 3, Score: 50},
+	}
+}
+
+/*
+Input: rule type
+Todo : Check the rule type is supported
+Output: true when known
+*/
+func IsKnownRule(ruleType string) bool {
+	switch ruleType {
+	case RuleWorkspaceVelocity, RuleExtensionVelocity, RuleSpendVelocity, RulePremiumPrefix, RuleUnusualHours, RuleNewCountryBurst:
+		return true
+	}
+	return false
+}
+
+/*
+Input: action
+Todo : Check the action is one a rule can take
+Output: true when known
+*/
+func IsKnownAction(action string) bool {
+	_, ok := severity[action]
+	return ok && action != ActionAllow
+}
+
+/*
+Input: rules, FraudCheck model, FraudActivity model
+Todo : Run every rule against the call, sum the scores of the triggered rules and keep the most severe action
+Output: FraudDecision model, Action is ActionAllow when no rule triggered
+*/
+func Evaluate(rules []*model.FraudRule, check *model.FraudCheck, activity *model.FraudActivity) *model.FraudDecision {
+	decision := &model.FraudDecision{
+		WorkspaceId: check.WorkspaceId,
+		CallAPIId:   check.CallAPIId,
+		Extension:   check.Extension,
+		Destination: check.Destination,
+		Action:      ActionAllow,
+		Reasons:     make([]string, 0)}
+	for _, rule := range rules {
+		reason, triggered := evaluateRule(rule, check, activity)
+		if !triggered {
+			continue
+		}
+		decision.Score += rule.Score
+		decision.Reasons = append(decision.Reasons, reason)
+		if severity[rule.Action] > severity[decision.Action] {
+			decision.Action = rule.Action
+		}
+	}
+	return decision
+}
+
+func evaluateRule(rule *model.FraudRule, check *model.FraudCheck, activity *model.FraudActivity) (string, bool) {
+	switch rule.Type {
+	case RuleWorkspaceVelocity:
+		calls := activity.WorkspaceCallsLastMinute + 1
+		return fmt.Sprintf("%d outbound calls in the last minute, limit is %.0f", calls, rule.Threshold), float64(calls) > rule.Threshold
+	case RuleExtensionVelocity:
+		if check.Extension == "" {
+			return "", false
+		}
+		calls := activity.ExtensionCallsLastMinute + 1
+		return fmt.Sprintf("%d outbound calls from %s in the last minute, limit is %.0f", calls, check.Extension, rule.Threshold), float64(calls) > rule.Threshold
+	case RuleSpendVelocity:
+		return fmt.Sprintf("spent %.2f cents in the last hour, limit is %.2f", activity.SpendLastHourCents, rule.Threshold), activity.SpendLastHourCents > rule.Threshold
+	case RulePremiumPrefix:
+		digits := utils.NormalizeDialNumber(check.Destination)
+		for _, prefix := range rule.Prefixes {
+			prefix = utils.NormalizeDialNumber(prefix)
+			if prefix != "" && strings.HasPrefix(digits, prefix) {
+				return fmt.Sprintf("destination %s matches premium rate prefix %s", check.Destination, prefix), true
+			}
+		}
+	case RuleUnusualHours:
+		at := check.At
+		if location, err := time.LoadLocation(rule.Timezone); err == nil {
+			at = at.In(location)
+		}
+		if inHours(at.Hour(), rule.StartHour, rule.EndHour) {
+			return fmt.Sprintf("call at %s is within unusual hours %02d:00-%02d:00", at.Format("15:04 MST"), rule.StartHour, rule.EndHour), true
+		}
+	case RuleNewCountryBurst:
+		countries := activity.NewCountriesLastHour
+		return fmt.Sprintf("%d new destination countries in the last hour, limit is %.0f", countries, rule.Threshold), float64(countries) > rule.Threshold
+	}
+	return "", false
+}
+
+// Windows ending before they start wrap around midnight
+func inHours(hour, start, end int) bool {
+	if start == end {
+		return false
+	}
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+/*
+Input: FraudDecision model, suspend score
+Todo : Check whether the decision is severe enough to suspend the workspace, a score of 0 or less disables suspensions
+Output: true when the workspace must be suspended
+*/
+func ShouldSuspend(decision *model.FraudDecision, suspendScore int) bool {
+	return suspendScore > 0 && decision.Score >= suspendScore
+}
@@ -0,0 +1,131 @@
+package fraud
+
+import (
+	"testing"
+	"time"
+
+	"lineblocs.com/api/model"
+)
+
+func TestEvaluate(t *testing.T) {
+	at := time.Date(2026, 3, 10, 3, 30, 0, 0, time.UTC)
+	velocity := &model.FraudRule{Type: RuleWorkspaceVelocity, Action: ActionAlert, Threshold: 10, Score: 40}
+	extension := &model.FraudRule{Type: RuleExtensionVelocity, Action: ActionScore, Threshold: 5, Score: 10}
+	spend := &model.FraudRule{Type: RuleSpendVelocity, Action: ActionAlert, Threshold: 500, Score: 30}
+	premium := &model.FraudRule{Type: RulePremiumPrefix, Action: ActionBlock, Score: 100, Prefixes: []string{"+1900", "882"}}
+	hours := &model.FraudRule{Type: RuleUnusualHours, Action: ActionScore, Score: 20, StartHour: 22, EndHour: 6}
+	countries := &model.FraudRule{Type: RuleNewCountryBurst, Action: ActionAlert, Threshold: 2, Score: 25}
+
+	tests := []struct {
+		name        string
+		rules       []*model.FraudRule
+		check       model.FraudCheck
+		activity    model.FraudActivity
+		wantAction  string
+		wantScore   int
+		wantReasons int
+	}{
+		{"no rules", nil, model.FraudCheck{Destination: "+19005550100", At: at}, model.FraudActivity{}, ActionAllow, 0, 0},
+		{"nothing triggered", []*model.FraudRule{velocity, spend, premium},
+			model.FraudCheck{Destination: "+14165550100", At: at}, model.FraudActivity{WorkspaceCallsLastMinute: 9, SpendLastHourCents: 500}, ActionAllow, 0, 0},
+		{"velocity counts the checked call", []*model.FraudRule{velocity},
+			model.FraudCheck{Destination: "+14165550100", At: at}, model.FraudActivity{WorkspaceCallsLastMinute: 10}, ActionAlert, 40, 1},
+		{"extension velocity needs an extension", []*model.FraudRule{extension},
+			model.FraudCheck{Destination: "+14165550100", At: at}, model.FraudActivity{ExtensionCallsLastMinute: 50}, ActionAllow, 0, 0},
+		{"extension velocity", []*model.FraudRule{extension},
+			model.FraudCheck{Extension: "1001", Destination: "+14165550100", At: at}, model.FraudActivity{ExtensionCallsLastMinute: 5}, ActionScore, 10, 1},
+		{"premium prefix ignores formatting", []*model.FraudRule{premium},
+			model.FraudCheck{Destination: "+1 (900) 555-0100", At: at}, model.FraudActivity{}, ActionBlock, 100, 1},
+		{"new country burst", []*model.FraudRule{countries},
+			model.FraudCheck{Destination: "+14165550100", At: at}, model.FraudActivity{NewCountriesLastHour: 3}, ActionAlert, 25, 1},
+		{"scores add up, most severe action wins", []*model.FraudRule{hours, premium, velocity, spend},
+			model.FraudCheck{Destination: "+8825550100", At: at}, model.FraudActivity{WorkspaceCallsLastMinute: 20, SpendLastHourCents: 501}, ActionBlock, 190, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, activity := tt.check, tt.activity
+			decision := Evaluate(tt.rules, &check, &activity)
+			if decision.Action != tt.wantAction {
+				t.Errorf("action = %s, want %s", decision.Action, tt.wantAction)
+			}
+			if decision.Score != tt.wantScore {
+				t.Errorf("score = %d, want %d", decision.Score, tt.wantScore)
+			}
+			if len(decision.Reasons) != tt.wantReasons {
+				t.Errorf("reasons = %q, want %d", decision.Reasons, tt.wantReasons)
+			}
+			if decision.Destination != check.Destination {
+				t.Errorf("destination = %s, want %s", decision.Destination, check.Destination)
+			}
+		})
+	}
+}
+
+func TestEvaluateUnusualHoursTimezone(t *testing.T) {
+	rule := &model.FraudRule{Type: RuleUnusualHours, Action: ActionAlert, Score: 20, StartHour: 0, EndHour: 6, Timezone: "America/Toronto"}
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"night in the rule's timezone", time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC), ActionAlert},
+		{"night in UTC only", time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC), ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Evaluate([]*model.FraudRule{rule}, &model.FraudCheck{At: tt.at}, &model.FraudActivity{})
+			if decision.Action != tt.want {
+				t.Errorf("action = %s, want %s (%q)", decision.Action, tt.want, decision.Reasons)
+			}
+		})
+	}
+}
+
+func TestInHours(t *testing.T) {
+	tests := []struct {
+		hour, start, end int
+		want             bool
+	}{
+		{9, 9, 17, true},
+		{16, 9, 17, true},
+		{17, 9, 17, false},
+		{8, 9, 17, false},
+		{23, 22, 6, true},
+		{0, 22, 6, true},
+		{5, 22, 6, true},
+		{6, 22, 6, false},
+		{21, 22, 6, false},
+		{12, 0, 0, false},
+		{0, 5, 5, false},
+	}
+	for _, tt := range tests {
+		if got := inHours(tt.hour, tt.start, tt.end); got != tt.want {
+			t.Errorf("inHours(%d, %d, %d) = %v, want %v", tt.hour, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestShouldSuspend(t *testing.T) {
+	tests := []struct {
+		score, suspendScore int
+		want                bool
+	}{
+		{100, 100, true},
+		{99, 100, false},
+		{500, 0, false},
+		{500, -1, false},
+	}
+	for _, tt := range tests {
+		if got := ShouldSuspend(&model.FraudDecision{Score: tt.score}, tt.suspendScore); got != tt.want {
+			t.Errorf("ShouldSuspend(%d, %d) = %v, want %v", tt.score, tt.suspendScore, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultRulesAreKnown(t *testing.T) {
+	for _, rule := range DefaultRules() {
+		if !IsKnownRule(rule.Type) || !IsKnownAction(rule.Action) {
+			t.Errorf("default rule %+v is not known", rule)
+		}
+	}
+}
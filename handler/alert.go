@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+// Workspace params holding the billing alert thresholds, in cents
+const (
+	lowBalanceThresholdParam = "low_balance_threshold_cents"
+	dailySpendThresholdParam = "daily_spend_threshold_cents"
+)
+
+// Billing alert types, each is sent at most once per day
+const (
+	lowBalanceAlert = "low_balance"
+	dailySpendAlert = "daily_spend"
+)
+
+/*
+Input: Workspace model
+Todo : Check the billing thresholds of the workspace after a debit and notify once per day when one is crossed
+Output: none, failures are logged since the debit is already stored
+*/
+func (h *Handler) checkBillingAlerts(workspace *model.Workspace) {
+	params, err := h.userStore.GetWorkspaceParams(workspace.Id)
+	if err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not get workspace params for billing alerts: %s", err.Error()))
+		return
+	}
+	now := time.Now()
+	period := now.Format("2006-01-02")
+
+	if threshold, ok := getThresholdParam(params, lowBalanceThresholdParam); ok {
+		balance, err := h.debitStore.GetWorkspaceBalance(workspace)
+		if err != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not get balance for billing alerts: %s", err.Error()))
+		} else if balance <= threshold {
+			h.sendBillingAlert(workspace, lowBalanceAlert, period,
+				"Low balance warning",
+				fmt.Sprintf("Your balance is $%.2f, which is below your alert threshold of $%.2f. Add credit to avoid calls being refused.", balance/100, threshold/100))
+		}
+	}
+
+	if threshold, ok := getThresholdParam(params, dailySpendThresholdParam); ok {
+		spend, err := h.debitStore.GetDailySpend(workspace, now)
+		if err != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not get daily spend for billing alerts: %s", err.Error()))
+		} else if spend >= threshold {
+			h.sendBillingAlert(workspace, dailySpendAlert, period,
+				"Daily spend warning",
+				fmt.Sprintf("You have spent $%.2f today, which is above your daily alert threshold of $%.2f.", spend/100, threshold/100))
+		}
+	}
+}
+
+func (h *Handler) sendBillingAlert(workspace *model.Workspace, alertType string, period string, title string, report string) {
+	claimed, err := h.debitStore.ClaimBillingAlert(workspace, alertType, period)
+	if err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not claim %s billing alert: %s", alertType, err.Error()))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	utils.Log(logrus.InfoLevel, fmt.Sprintf("Sending %s billing alert to workspace %d", alertType, workspace.Id))
+	log := &model.LogRoutine{
+		From:        "",
+		To:          "",
+		Level:       "warning",
+		Title:       title,
+		Report:      report,
+		UserId:      workspace.CreatorId,
+		WorkspaceId: workspace.Id}
+	_, err = h.loggerStore.StartLogRoutine(workspace, log)
+	if err == nil {
+		return
+	}
+	utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not send %s billing alert: %s", alertType, err.Error()))
+	// the alert was not sent, let the next debit of the period try again
+	if err := h.debitStore.ReleaseBillingAlert(workspace, alertType, period); err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not release %s billing alert: %s", alertType, err.Error()))
+	}
+}
+
+func getThresholdParam(params *[]model.WorkspaceParam, key string) (float64, bool) {
+	value, ok := utils.GetWorkspaceParam(params, key)
+	if !ok || value == "" {
+		return 0, false
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Invalid %s workspace param %q", key, value))
+		return 0, false
+	}
+	return threshold, true
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"lineblocs.com/api/debit"
+	"lineblocs.com/api/logger"
+	"lineblocs.com/api/model"
+)
+
+func TestGetThresholdParam(t *testing.T) {
+	params := &[]model.WorkspaceParam{
+		{Key: lowBalanceThresholdParam, Value: "500"},
+		{Key: dailySpendThresholdParam, Value: "ten dollars"},
+		{Key: "empty_threshold", Value: ""},
+	}
+	tests := []struct {
+		key    string
+		want   float64
+		wantOk bool
+	}{
+		{lowBalanceThresholdParam, 500, true},
+		{dailySpendThresholdParam, 0, false},
+		{"empty_threshold", 0, false},
+		{"missing_threshold", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := getThresholdParam(params, tt.key)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("getThresholdParam(%s) = %g, %v, want %g, %v", tt.key, got, ok, tt.want, tt.wantOk)
+		}
+	}
+	if _, ok := getThresholdParam(nil, lowBalanceThresholdParam); ok {
+		t.Error("threshold found without params")
+	}
+}
+
+type fakeAlertDebitStore struct {
+	debit.Store
+	claimed map[string]bool
+}
+
+func (s *fakeAlertDebitStore) ClaimBillingAlert(workspace *model.Workspace, alertType string, period string) (bool, error) {
+	key := alertType + "@" + period
+	if s.claimed[key] {
+		return false, nil
+	}
+	s.claimed[key] = true
+	return true, nil
+}
+
+func (s *fakeAlertDebitStore) ReleaseBillingAlert(workspace *model.Workspace, alertType string, period string) error {
+	delete(s.claimed, alertType+"@"+period)
+	return nil
+}
+
+type failingLoggerStore struct {
+	logger.Store
+	failures int
+	sent     int
+}
+
+func (s *failingLoggerStore) StartLogRoutine(workspace *model.Workspace, log *model.LogRoutine) (*string, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("smtp unavailable")
+	}
+	s.sent++
+	id := "log"
+	return &id, nil
+}
+
+func TestSendBillingAlert(t *testing.T) {
+	debitStore := &fakeAlertDebitStore{claimed: make(map[string]bool)}
+	loggerStore := &failingLoggerStore{failures: 1}
+	h := &Handler{debitStore: debitStore, loggerStore: loggerStore}
+	workspace := &model.Workspace{Id: 4}
+
+	h.sendBillingAlert(workspace, lowBalanceAlert, "2026-10-17", "Low balance warning", "report")
+	if debitStore.claimed[lowBalanceAlert+"@2026-10-17"] {
+		t.Fatal("claim was kept after the alert failed to send")
+	}
+
+	h.sendBillingAlert(workspace, lowBalanceAlert, "2026-10-17", "Low balance warning", "report")
+	h.sendBillingAlert(workspace, lowBalanceAlert, "2026-10-17", "Low balance warning", "report")
+	if loggerStore.sent != 1 {
+		t.Errorf("sent %d alerts, want 1 after the failed attempt", loggerStore.sent)
+	}
+	if !debitStore.claimed[lowBalanceAlert+"@2026-10-17"] {
+		t.Error("alert that was sent is not claimed")
+	}
+}
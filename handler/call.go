@@ -1,15 +1,29 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	callstate "lineblocs.com/api/call"
+	"lineblocs.com/api/fraud"
+	"lineblocs.com/api/idempotency"
 	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
 
+// Page size of call listings
+const (
+	defaultCallListLimit = 50
+	maxCallListLimit     = 500
+)
+
 /*
 Input: Call model
 Todo : Create new call and store to db
@@ -27,17 +41,97 @@ func (h *Handler) CreateCall(c echo.Context) error {
 		return utils.HandleInternalErr("CreateCall 1 Could not decode JSON", err, c)
 	}
 
+	call.IdempotencyKey = utils.GetIdempotencyKey(c, call.IdempotencyKey)
+	existingId, found, err := h.lookupIdempotentRequest(c, idempotency.Calls, call.WorkspaceId, call.IdempotencyKey)
+	if err != nil {
+		return utils.HandleInternalErr("CreateCall could not lookup idempotency key..", err, c)
+	}
+	if found {
+		existing, err := h.callStore.GetCallFromDB(int(existingId))
+		if err != nil {
+			return utils.HandleInternalErr("CreateCall could not get call..", err, c)
+		}
+		if conflict, err := replayConflict(c, call.WorkspaceId, existing.WorkspaceId); conflict {
+			return err
+		}
+		c.Response().Writer.Header().Set("X-Call-ID", strconv.FormatInt(existingId, 10))
+		return c.JSON(http.StatusOK, &existing)
+	}
+
+	if call.Status == "" {
+		call.Status = callstate.StatusInitiated
+	}
+	if !callstate.IsKnownStatus(call.Status) || callstate.IsTerminal(call.Status) {
+		return c.JSON(http.StatusBadRequest, fmt.Sprintf("%s: %s", utils.ErrUnknownCallStatus.Error(), call.Status))
+	}
+
+	if err := h.validateCallLeg(&call); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
 	call.APIId = utils.CreateAPIID("call")
+	call.MediaServerIp = call.SourceIp
+	if call.MediaServerIp == "" {
+		call.MediaServerIp = c.RealIP()
+	}
 
+	workspace, err := h.callStore.GetWorkspaceFromDB(call.WorkspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("CreateCall could not get workspace..", err, c)
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("CreateCall could not get plan..", err, c)
+	}
+	var country *model.CalledCountry
 	if call.Direction == "outbound" {
-		// Check if this is the first time we are making a call to this destination
-		go h.callStore.CheckIsMakingOutboundCallFirstTime(call)
+		suspension, err := h.fraudStore.GetSuspension(workspace.Id)
+		if err != nil {
+			return utils.HandleInternalErr("CreateCall could not check suspension..", err, c)
+		}
+		if suspension != nil {
+			return workspaceSuspended(c, suspension)
+		}
+
+		// Check if calls to the destination country are allowed, the country is recorded once the call is created
+		destination, allowed, err := h.checkDestinationCountry(workspace, &call)
+		if err != nil {
+			return utils.HandleInternalErr("CreateCall could not check destination country..", err, c)
+		}
+		if !allowed {
+			return c.JSON(http.StatusForbidden, "calls to this destination country need to be approved")
+		}
+		country = destination
+
+		decision, err := h.checkFraud(workspace, &call)
+		if err != nil {
+			return utils.HandleInternalErr("CreateCall could not run fraud checks..", err, c)
+		}
+		if decision.Action == fraud.ActionBlock || decision.Suspended {
+			return c.JSON(http.StatusForbidden, "call refused by fraud checks: "+strings.Join(decision.Reasons, "; "))
+		}
 	}
 
-	callId, err := h.callStore.CreateCall(&call)
+	if !h.callTracker.TryAdd(workspace.Id, call.APIId, plan.ConcurrentCallLimit) {
+		return capacityExceeded(c, workspace.Id)
+	}
+
+	callId, err := h.callStore.CreateCall(&call, plan.ConcurrentCallLimit, h.callTracker.TTL())
+	if err != nil {
+		h.callTracker.Remove(workspace.Id, call.APIId)
+	}
+	if err == utils.ErrCapacityExceeded {
+		return capacityExceeded(c, workspace.Id)
+	}
+	if err == utils.ErrIdempotencyConflict {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
 	if err != nil {
 		return utils.HandleInternalErr("CreateCall Could not execute query", err, c)
 	}
+	if country != nil {
+		h.recordDestinationCountry(workspace, country)
+	}
 
 	c.Response().Writer.Header().Set("X-Call-ID", callId)
 	return c.JSON(http.StatusOK, &call)
@@ -60,17 +154,128 @@ func (h *Handler) UpdateCall(c echo.Context) error {
 		return utils.HandleInternalErr("UpdateCall 2 Could not decode JSON", err, c)
 	}
 
-	// Only update if status is "ended"
-	if update.Status == "ended" {
-		err := h.callStore.UpdateCall(&update)
+	at := time.Now()
+	if update.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, update.Timestamp)
 		if err != nil {
-			return utils.HandleInternalErr("UpdateCall Could not execute query..", err, c)
+			return c.JSON(http.StatusBadRequest, "timestamp must be in RFC3339 format")
 		}
+		at = parsed
 	}
 
+	err := h.callStore.UpdateCall(&update, at)
+	if errors.Is(err, utils.ErrUnknownCallStatus) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, utils.ErrInvalidCallTransition) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("UpdateCall Could not execute query..", err, c)
+	}
+
+	h.trackCallUpdate(&update, at)
 	return c.NoContent(http.StatusNoContent)
 }
 
+// Terminal updates free the call's slot in the concurrent call limit and take it out of its conferences,
+// other updates keep it from going stale
+func (h *Handler) trackCallUpdate(update *model.CallUpdate, at time.Time) {
+	tracked, err := h.callStore.GetCallFromDB(update.CallId)
+	if err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not get call %d to track it: %s", update.CallId, err.Error()))
+		return
+	}
+	if callstate.IsTerminal(update.Status) {
+		h.callTracker.Remove(tracked.WorkspaceId, tracked.APIId)
+		if err := h.conferenceStore.LeaveAllConferences(tracked.APIId, at); err != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not remove call %s from its conferences: %s", tracked.APIId, err.Error()))
+		}
+		return
+	}
+	h.callTracker.Touch(tracked.WorkspaceId, tracked.APIId)
+}
+
+/*
+Input: workspace_id
+Todo : Get the number of calls in progress for a workspace and its plan limit
+Output: If success return ActiveCallCount model else return err
+*/
+func (h *Handler) GetActiveCallCount(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetActiveCallCount is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetActiveCallCount could not get workspace..", err, c)
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("GetActiveCallCount could not get plan..", err, c)
+	}
+	active, err := h.callStore.CountActiveCalls(workspace.Id, h.callTracker.TTL())
+	if err != nil {
+		return utils.HandleInternalErr("GetActiveCallCount could not count calls..", err, c)
+	}
+	count := &model.ActiveCallCount{
+		WorkspaceId: workspace.Id,
+		ActiveCalls: active,
+		Limit:       plan.ConcurrentCallLimit}
+	return c.JSON(http.StatusOK, &count)
+}
+
+/*
+Input: workspace id
+Todo : Check the workspace is below the concurrent call limit of its plan before a call is let in
+Output: First Value: true if there is capacity, Second Value: error
+*/
+func (h *Handler) hasCallCapacity(workspaceId int) (bool, error) {
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return false, err
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return false, err
+	}
+	active, err := h.callStore.CountActiveCalls(workspace.Id, h.callTracker.TTL())
+	if err != nil {
+		return false, err
+	}
+	return utils.WithinPlanLimit(plan.ConcurrentCallLimit, active+1), nil
+}
+
+func capacityExceeded(c echo.Context, workspaceId int) error {
+	utils.Log(logrus.WarnLevel, fmt.Sprintf("Workspace %d reached its concurrent call limit", workspaceId))
+	c.Response().Header().Set(utils.HeaderCapacityExceeded, "true")
+	return c.JSON(http.StatusTooManyRequests, utils.ErrCapacityExceeded.Error())
+}
+
+/*
+Input: id
+Todo : Get the events media servers reported for a call, including rejected ones
+Output: If success return list of CallEvent model else return err
+*/
+func (h *Handler) GetCallEvents(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetCallEvents is called...")
+
+	id, err := strconv.Atoi(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid id")
+	}
+	events, err := h.callStore.GetCallEvents(id)
+	if err != nil {
+		return utils.HandleInternalErr("GetCallEvents could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &events)
+}
+
 /*
 Input: id
 Todo : Fetch a call with call_id
@@ -129,28 +334,127 @@ func (h *Handler) SetProviderByIP(c echo.Context) error {
 }
 
 /*
-Input: Conference model
-Todo : Create new conference and store to db
-Output: If success return created Conference model with conferenceId in header else return err
+Input: workspace_id, direction, status, from, to (number prefixes), start_date, end_date, provider_id, sip_status,
+sort (started_at or duration), order (asc or desc), cursor, limit
+Todo : List the calls of a workspace matching the filters using keyset cursor pagination
+Output: If success return CallList model with the total and the cursor of the next page else return err
 */
-func (h *Handler) CreateConference(c echo.Context) error {
-	utils.Log(logrus.InfoLevel, "CreateConference is called...")
+func (h *Handler) ListCalls(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ListCalls is called...")
 
-	var conference model.Conference
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	filter := &model.CallFilter{
+		WorkspaceId: workspaceId,
+		Direction:   c.QueryParam("direction"),
+		Status:      c.QueryParam("status"),
+		FromPrefix:  c.QueryParam("from"),
+		ToPrefix:    c.QueryParam("to"),
+		SortBy:      c.QueryParam("sort"),
+		Descending:  c.QueryParam("order") != "asc",
+		Cursor:      c.QueryParam("cursor"),
+		Limit:       defaultCallListLimit}
+	if filter.SortBy == "" {
+		filter.SortBy = "started_at"
+	}
+	if filter.SortBy != "started_at" && filter.SortBy != "duration" {
+		return c.JSON(http.StatusBadRequest, "sort must be started_at or duration")
+	}
+	if order := c.QueryParam("order"); order != "" && order != "asc" && order != "desc" {
+		return c.JSON(http.StatusBadRequest, "order must be asc or desc")
+	}
+	if value := c.QueryParam("start_date"); value != "" {
+		start, err := utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid start_date")
+		}
+		filter.StartedFrom = &start
+	}
+	if value := c.QueryParam("end_date"); value != "" {
+		end, err := utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid end_date")
+		}
+		filter.StartedTo = &end
+	}
+	if value := c.QueryParam("provider_id"); value != "" {
+		filter.ProviderId, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid provider_id")
+		}
+	}
+	if value := c.QueryParam("sip_status"); value != "" {
+		filter.SIPStatus, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid sip_status")
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxCallListLimit {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxCallListLimit))
+		}
+	}
 
-	if err := c.Bind(&conference); err != nil {
-		return utils.HandleInternalErr("CreateConference 1 Could not decode JSON", err, c)
+	list, err := h.callStore.ListCalls(filter)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, err.Error())
 	}
-	if err := c.Validate(&conference); err != nil {
-		return utils.HandleInternalErr("CreateConference 2 Could not decode JSON", err, c)
+	if err != nil {
+		return utils.HandleInternalErr("ListCalls could not execute query..", err, c)
 	}
+	return c.JSON(http.StatusOK, &list)
+}
 
-	conferenceId, err := h.callStore.CreateConference(&conference)
+// Legs other than the original must point to a parent call of the same workspace
+func (h *Handler) validateCallLeg(call *model.Call) error {
+	switch call.LegType {
+	case "":
+		if call.ParentCallId != 0 {
+			return errors.New("leg_type is required with parent_call_id")
+		}
+		call.LegType = model.LegTypeOriginal
+		return nil
+	case model.LegTypeOriginal:
+		if call.ParentCallId != 0 {
+			return errors.New("original legs cannot have a parent_call_id")
+		}
+		return nil
+	case model.LegTypeForward, model.LegTypeTransfer, model.LegTypeConferenceJoin:
+	default:
+		return fmt.Errorf("unknown leg_type %s", call.LegType)
+	}
 
-	if err != nil {
-		return utils.HandleInternalErr("CreateConference error occured", err, c)
+	if call.ParentCallId == 0 {
+		return fmt.Errorf("parent_call_id is required for %s legs", call.LegType)
 	}
+	parent, err := h.callStore.GetCallFromDB(call.ParentCallId)
+	if err != nil || parent.WorkspaceId != call.WorkspaceId {
+		return fmt.Errorf("parent call %d not found", call.ParentCallId)
+	}
+	return nil
+}
+
+/*
+Input: id of any leg of a call
+Todo : Get every leg linked to the call, from the original leg down, with the combined duration and cost
+Output: If success return CallLegTree model else return err
+*/
+func (h *Handler) GetCallLegs(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetCallLegs is called...")
 
-	c.Response().Writer.Header().Set("X-Conference-ID", conferenceId)
-	return c.JSON(http.StatusOK, &conference)
+	id, err := strconv.Atoi(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid id")
+	}
+	tree, err := h.callStore.GetCallLegTree(id)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("GetCallLegs could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &tree)
 }
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"database/sql"
+	"testing"
+
+	"lineblocs.com/api/call"
+	"lineblocs.com/api/model"
+)
+
+type fakeCallStore struct {
+	call.Store
+	calls map[int]*model.Call
+}
+
+func (s *fakeCallStore) GetCallFromDB(id int) (*model.Call, error) {
+	if c, ok := s.calls[id]; ok {
+		return c, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestValidateCallLeg(t *testing.T) {
+	h := &Handler{callStore: &fakeCallStore{calls: map[int]*model.Call{
+		1: {Id: 1, WorkspaceId: 10},
+	}}}
+	tests := []struct {
+		name     string
+		call     model.Call
+		wantErr  bool
+		wantType string
+	}{
+		{"defaults to original", model.Call{WorkspaceId: 10}, false, model.LegTypeOriginal},
+		{"parent without leg type", model.Call{WorkspaceId: 10, ParentCallId: 1}, true, ""},
+		{"original with parent", model.Call{WorkspaceId: 10, ParentCallId: 1, LegType: model.LegTypeOriginal}, true, model.LegTypeOriginal},
+		{"unknown leg type", model.Call{WorkspaceId: 10, ParentCallId: 1, LegType: "bridge"}, true, "bridge"},
+		{"forward without parent", model.Call{WorkspaceId: 10, LegType: model.LegTypeForward}, true, model.LegTypeForward},
+		{"forward", model.Call{WorkspaceId: 10, ParentCallId: 1, LegType: model.LegTypeForward}, false, model.LegTypeForward},
+		{"parent of another workspace", model.Call{WorkspaceId: 11, ParentCallId: 1, LegType: model.LegTypeTransfer}, true, model.LegTypeTransfer},
+		{"missing parent", model.Call{WorkspaceId: 10, ParentCallId: 2, LegType: model.LegTypeTransfer}, true, model.LegTypeTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.call
+			err := h.validateCallLeg(&c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if c.LegType != tt.wantType {
+				t.Errorf("leg type = %q, want %q", c.LegType, tt.wantType)
+			}
+		})
+	}
+}
@@ -3,31 +3,93 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 	"lineblocs.com/api/helpers"
+	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
 
 /*
-Input: callid, status
-Todo : Update sip_status of calls with matching sip_call_id
-Output: If success return NoContent else return err
+Input: callid, status, pdd_ms (optional)
+Todo : Update sip_status of calls with matching sip_call_id and record the attempt for carrier statistics
+Output: If success return NoContent, if status or pdd_ms are not numbers return StatusBadRequest else return err
 */
 func (h *Handler) CreateSIPReport(c echo.Context) error {
 	utils.Log(logrus.InfoLevel, "CreateSIPReport is called...")
 
-	callid := c.FormValue("callid")
-	status := c.FormValue("status")
+	report := &model.SIPReport{SIPCallId: c.FormValue("callid")}
+	status, err := strconv.Atoi(c.FormValue("status"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid status")
+	}
+	report.Status = status
+	if value := c.FormValue("pdd_ms"); value != "" {
+		pdd, err := strconv.Atoi(value)
+		if err != nil || pdd < 0 {
+			return c.JSON(http.StatusBadRequest, "invalid pdd_ms")
+		}
+		report.PDDMs = &pdd
+	}
 
-	err := h.carrierStore.CreateSIPReport(callid, status)
+	err = h.carrierStore.CreateSIPReport(report)
 	if err != nil {
 		return utils.HandleInternalErr("CreateSIPReport error", err, c)
 	}
 	return c.NoContent(http.StatusOK)
 }
 
+/*
+Input: start, end, provider_id (optional), dial_prefix (optional), group_by_prefix (optional), interval (hour or day, optional)
+Todo : Get ASR, ACD, post dial delay and failure codes of the carriers over the period
+Output: If success return CarrierStats model slice, if the input is invalid return StatusBadRequest else return err
+*/
+func (h *Handler) GetCarrierStats(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetCarrierStats is called...")
+
+	var err error
+	filter := &model.CarrierStatsFilter{
+		DialPrefix: c.QueryParam("dial_prefix"),
+		ByPrefix:   c.QueryParam("group_by_prefix") == "true",
+		Interval:   c.QueryParam("interval")}
+	if filter.Interval != "" && filter.Interval != "hour" && filter.Interval != "day" {
+		return c.JSON(http.StatusBadRequest, "interval must be hour or day")
+	}
+	if value := c.QueryParam("provider_id"); value != "" {
+		filter.ProviderId, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid provider_id")
+		}
+	}
+	filter.End = time.Now()
+	if value := c.QueryParam("end"); value != "" {
+		filter.End, err = utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid end")
+		}
+	}
+	// last day by default
+	filter.Start = filter.End.Add(-24 * time.Hour)
+	if value := c.QueryParam("start"); value != "" {
+		filter.Start, err = utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid start")
+		}
+	}
+	if !filter.Start.Before(filter.End) {
+		return c.JSON(http.StatusBadRequest, "start must be before end")
+	}
+
+	stats, err := h.carrierStore.GetCarrierStats(filter)
+	if err != nil {
+		return utils.HandleInternalErr("GetCarrierStats error", err, c)
+	}
+	return c.JSON(http.StatusOK, &stats)
+}
+
 /*
 Input: callto, callfrom, userid
 Todo : Create and Start Router Flow
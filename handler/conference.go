@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/conference"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+// Page size of conference session listings
+const (
+	defaultConferenceSessionLimit = 50
+	maxConferenceSessionLimit     = 500
+)
+
+/*
+Input: Conference model
+Todo : Create new conference with its participant cap, schedule window and hashed PINs and store to db
+Output: If success return created Conference model with conferenceId in header, if the settings are invalid return StatusBadRequest,
+if settings are sent for an existing conference return StatusConflict else return err
+*/
+func (h *Handler) CreateConference(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "CreateConference is called...")
+
+	var conference model.Conference
+
+	if err := c.Bind(&conference); err != nil {
+		return utils.HandleInternalErr("CreateConference 1 Could not decode JSON", err, c)
+	}
+	if err := c.Validate(&conference); err != nil {
+		return utils.HandleInternalErr("CreateConference 2 Could not decode JSON", err, c)
+	}
+	if err := validateConferenceSettings(&conference); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	conferenceId, err := h.conferenceStore.CreateConference(&conference)
+	if errors.Is(err, utils.ErrConferenceExists) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("CreateConference error occured", err, c)
+	}
+
+	c.Response().Writer.Header().Set("X-Conference-ID", conferenceId)
+	return c.JSON(http.StatusOK, &conference)
+}
+
+/*
+Input: Conference model with api_id
+Todo : Replace the participant cap and schedule window of a conference, PINs that are sent replace the stored ones
+and clear_moderator_pin or clear_attendee_pin remove them
+Output: If success return Conference model, if the settings are invalid return StatusBadRequest else return err
+*/
+func (h *Handler) UpdateConferenceSettings(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "UpdateConferenceSettings is called...")
+
+	var settings model.Conference
+
+	if err := c.Bind(&settings); err != nil {
+		return utils.HandleInternalErr("UpdateConferenceSettings 1 Could not decode JSON", err, c)
+	}
+	if err := c.Validate(&settings); err != nil {
+		return utils.HandleInternalErr("UpdateConferenceSettings 2 Could not decode JSON", err, c)
+	}
+
+	conf, err := h.conferenceStore.GetConference(settings.APIId)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "conference not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("UpdateConferenceSettings could not get conference..", err, c)
+	}
+	conf.MaxParticipants = settings.MaxParticipants
+	conf.StartsAt = settings.StartsAt
+	conf.EndsAt = settings.EndsAt
+	conf.ModeratorPin = settings.ModeratorPin
+	conf.AttendeePin = settings.AttendeePin
+	conf.ClearModeratorPin = settings.ClearModeratorPin
+	conf.ClearAttendeePin = settings.ClearAttendeePin
+	if err := validateConferenceSettings(conf); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.conferenceStore.UpdateConferenceSettings(conf); err != nil {
+		return utils.HandleInternalErr("UpdateConferenceSettings error", err, c)
+	}
+	return c.JSON(http.StatusOK, &conf)
+}
+
+// Check the cap and schedule window of a conference and hash the PINs sent with it
+func validateConferenceSettings(conf *model.Conference) error {
+	if conf.MaxParticipants != nil && *conf.MaxParticipants < 1 {
+		return errors.New("max_participants must be at least 1")
+	}
+	if conf.StartsAt != nil && conf.EndsAt != nil && !conf.EndsAt.After(*conf.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return conference.HashPins(conf)
+}
+
+/*
+Input: Conference model
+Todo : Get the participant cap of a conference from the workspace plan and the conference's own limit
+Output: First Value: participant limit, nil when unlimited, Second Value: error
+*/
+func (h *Handler) getParticipantLimit(conf *model.Conference) (*int, error) {
+	workspace, err := h.callStore.GetWorkspaceFromDB(conf.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return conference.ParticipantLimit(plan, conf), nil
+}
+
+/*
+Input: conference_id (api id), pin (optional)
+Todo : Check whether a caller may enter the conference before the media server admits them, looking at the schedule window,
+the PINs and the participant cap
+Output: If success return ConferenceAdmission model with the role to use, if the conference is not found return StatusNotFound else return err
+*/
+func (h *Handler) ValidateConferenceParticipant(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ValidateConferenceParticipant is called...")
+
+	conf, err := h.conferenceStore.GetConference(c.FormValue("conference_id"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "conference not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("ValidateConferenceParticipant could not get conference..", err, c)
+	}
+	limit, err := h.getParticipantLimit(conf)
+	if err != nil {
+		return utils.HandleInternalErr("ValidateConferenceParticipant could not get participant limit..", err, c)
+	}
+	participants, err := h.conferenceStore.CountLiveParticipants(conf.Id)
+	if err != nil {
+		return utils.HandleInternalErr("ValidateConferenceParticipant could not count participants..", err, c)
+	}
+
+	admission := conference.Admit(conf, limit, participants, c.FormValue("pin"), time.Now())
+	if !admission.Allowed {
+		utils.Log(logrus.InfoLevel, fmt.Sprintf("Denied caller to conference %s: %s", conf.APIId, admission.Reason))
+	}
+	return c.JSON(http.StatusOK, &admission)
+}
+
+/*
+Input: conference_id, call_id (api ids), role (defaults to attendee)
+Todo : Record a call joining the conference, the first participant starts a new session
+Output: If success return ConferenceParticipant model, if the call already joined or the conference is full return StatusConflict else return err
+*/
+func (h *Handler) JoinConference(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "JoinConference is called...")
+
+	conferenceId := c.FormValue("conference_id")
+	callId := c.FormValue("call_id")
+	if conferenceId == "" || callId == "" {
+		return c.JSON(http.StatusBadRequest, "conference_id and call_id are required")
+	}
+	role := c.FormValue("role")
+	if role == "" {
+		role = conference.RoleAttendee
+	}
+	if !conference.IsKnownRole(role) {
+		return c.JSON(http.StatusBadRequest, fmt.Sprintf("unknown role %s", role))
+	}
+
+	conf, err := h.conferenceStore.GetConference(conferenceId)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "conference not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("JoinConference could not get conference..", err, c)
+	}
+	limit, err := h.getParticipantLimit(conf)
+	if err != nil {
+		return utils.HandleInternalErr("JoinConference could not get participant limit..", err, c)
+	}
+
+	participant, err := h.conferenceStore.JoinConference(conferenceId, callId, role, limit, time.Now())
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "conference or call not found")
+	}
+	if errors.Is(err, utils.ErrConferenceFull) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, utils.ErrConferenceWorkspace) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, utils.ErrAlreadyInConference) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("JoinConference error", err, c)
+	}
+	return c.JSON(http.StatusOK, &participant)
+}
+
+/*
+Input: conference_id, call_id (api ids)
+Todo : Record a call leaving the conference, the session ends when the last participant leaves
+Output: If success return ConferenceParticipant model, if the call is not in the conference return StatusNotFound else return err
+*/
+func (h *Handler) LeaveConference(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "LeaveConference is called...")
+
+	participant, err := h.conferenceStore.LeaveConference(c.FormValue("conference_id"), c.FormValue("call_id"), time.Now())
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call is not in the conference")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("LeaveConference error", err, c)
+	}
+	return c.JSON(http.StatusOK, &participant)
+}
+
+/*
+Input: conference_id, call_id (api ids), role
+Todo : Change the role of a participant, e.g. to mute them or make them a moderator
+Output: If success return ConferenceParticipant model, if the call is not in the conference return StatusNotFound else return err
+*/
+func (h *Handler) UpdateParticipantRole(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "UpdateParticipantRole is called...")
+
+	role := c.FormValue("role")
+	if !conference.IsKnownRole(role) {
+		return c.JSON(http.StatusBadRequest, fmt.Sprintf("unknown role %s", role))
+	}
+	participant, err := h.conferenceStore.UpdateParticipantRole(c.FormValue("conference_id"), c.FormValue("call_id"), role)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call is not in the conference")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("UpdateParticipantRole error", err, c)
+	}
+	return c.JSON(http.StatusOK, &participant)
+}
+
+/*
+Input: conference_id (api id)
+Todo : Get the participants currently in the conference
+Output: If success return list of ConferenceParticipant model else return err
+*/
+func (h *Handler) GetLiveParticipants(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetLiveParticipants is called...")
+
+	participants, err := h.conferenceStore.GetLiveParticipants(c.QueryParam("conference_id"))
+	if err != nil {
+		return utils.HandleInternalErr("GetLiveParticipants error", err, c)
+	}
+	return c.JSON(http.StatusOK, &participants)
+}
+
+/*
+Input: conference_id (api id), limit (optional)
+Todo : Get the latest sessions of the conference with their participant count and participant seconds
+Output: If success return list of ConferenceSession model else return err
+*/
+func (h *Handler) GetConferenceSessions(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetConferenceSessions is called...")
+
+	var err error
+	limit := defaultConferenceSessionLimit
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxConferenceSessionLimit {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxConferenceSessionLimit))
+		}
+	}
+	sessions, err := h.conferenceStore.GetSessions(c.QueryParam("conference_id"), limit)
+	if err != nil {
+		return utils.HandleInternalErr("GetConferenceSessions error", err, c)
+	}
+	return c.JSON(http.StatusOK, &sessions)
+}
+
+/*
+Input: session_id
+Todo : Get everyone who took part in a conference session with their join and leave times
+Output: If success return list of ConferenceParticipant model else return err
+*/
+func (h *Handler) GetSessionParticipants(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetSessionParticipants is called...")
+
+	sessionId, err := strconv.Atoi(c.QueryParam("session_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid session_id")
+	}
+	participants, err := h.conferenceStore.GetSessionParticipants(sessionId)
+	if err != nil {
+		return utils.HandleInternalErr("GetSessionParticipants error", err, c)
+	}
+	return c.JSON(http.StatusOK, &participants)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/helpers"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+// Workspace params controlling calls to destination countries not called before
+const (
+	blockNewHighRiskCountriesParam = "block_new_high_risk_countries"
+	highRiskCountryCodesParam      = "high_risk_country_codes"
+)
+
+/*
+Input: Workspace model, Call model
+Todo : Find the destination country of an outbound call and refuse the call while the country is high risk,
+unapproved and the workspace blocks new high risk countries. A refused call records the country as pending approval,
+otherwise the country is recorded by recordDestinationCountry once the call is created
+Output: First Value: CalledCountry model, nil when the destination is not a phone number, Second Value: true when the call may proceed, Third Value: error
+*/
+func (h *Handler) checkDestinationCountry(workspace *model.Workspace, call *model.Call) (*model.CalledCountry, bool, error) {
+	digits := utils.NormalizeDialNumber(call.To)
+	if digits == "" {
+		return nil, true, nil
+	}
+	countryCode, err := helpers.ParseValidCountryCode("+" + digits)
+	if err != nil {
+		// SIP URIs and extensions have no destination country
+		utils.Log(logrus.InfoLevel, fmt.Sprintf("Could not get destination country of %s: %s", call.To, err.Error()))
+		return nil, true, nil
+	}
+
+	params, err := h.userStore.GetWorkspaceParams(workspace.Id)
+	if err != nil {
+		return nil, false, err
+	}
+	blockHighRisk := getBoolParam(params, blockNewHighRiskCountriesParam)
+	highRiskCodes, ok := utils.GetWorkspaceParam(params, highRiskCountryCodesParam)
+	if !ok || highRiskCodes == "" {
+		highRiskCodes = utils.Config("HIGH_RISK_COUNTRY_CODES")
+	}
+	highRisk := utils.IsHighRiskCountry(countryCode, highRiskCodes)
+
+	country := &model.CalledCountry{
+		WorkspaceId: workspace.Id,
+		CountryCode: countryCode,
+		FirstNumber: call.To,
+		HighRisk:    highRisk,
+		Approved:    true}
+	if !(blockHighRisk && highRisk) {
+		return country, true, nil
+	}
+
+	existing, err := h.callStore.GetCalledCountry(workspace.Id, countryCode)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, err
+	}
+	if existing == nil || !existing.Approved {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Refusing call from workspace %d to unapproved high risk country +%s", workspace.Id, countryCode))
+		country.Approved = false
+		h.recordDestinationCountry(workspace, country)
+		return country, false, nil
+	}
+	return country, true, nil
+}
+
+/*
+Input: Workspace model, CalledCountry model of a created call
+Todo : Record the destination country of the call and notify the owner when it is the first call to the country
+*/
+func (h *Handler) recordDestinationCountry(workspace *model.Workspace, country *model.CalledCountry) {
+	country, first, err := h.callStore.CheckIsMakingOutboundCallFirstTime(country)
+	if err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not record destination country of workspace %d: %s", workspace.Id, err.Error()))
+		return
+	}
+	if first {
+		go h.notifyNewDestinationCountry(workspace, country)
+	}
+}
+
+func (h *Handler) notifyNewDestinationCountry(workspace *model.Workspace, country *model.CalledCountry) {
+	utils.Log(logrus.InfoLevel, fmt.Sprintf("Workspace %d called country +%s for the first time", workspace.Id, country.CountryCode))
+	if err := h.callStore.SendNewDestinationEmail(workspace, country); err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not send new destination email: %s", err.Error()))
+	}
+
+	report := fmt.Sprintf("A call to %s was made for the first time to country code +%s.", country.FirstNumber, country.CountryCode)
+	if country.HighRisk {
+		report += " The country is high risk."
+	}
+	if !country.Approved {
+		report += " The call was refused, calls to the country need to be approved."
+	}
+	log := &model.LogRoutine{
+		To:          country.FirstNumber,
+		Level:       "info",
+		Title:       "First call to destination country",
+		Report:      report,
+		UserId:      workspace.CreatorId,
+		WorkspaceId: workspace.Id,
+		SkipEmail:   true}
+	if country.HighRisk {
+		log.Level = "warning"
+	}
+	if _, err := h.loggerStore.StartLogRoutine(workspace, log); err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not create new destination log: %s", err.Error()))
+	}
+}
+
+func getBoolParam(params *[]model.WorkspaceParam, key string) bool {
+	value, ok := utils.GetWorkspaceParam(params, key)
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && enabled
+}
+
+/*
+Input: workspace_id
+Todo : Get the destination countries the workspace has called and whether they are approved
+Output: If success return list of CalledCountry model else return err
+*/
+func (h *Handler) GetCalledCountries(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetCalledCountries is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	countries, err := h.callStore.GetCalledCountries(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetCalledCountries error", err, c)
+	}
+	return c.JSON(http.StatusOK, &countries)
+}
+
+/*
+Input: workspace_id, country_code
+Todo : Approve calls from the workspace to a destination country
+Output: If success return NoContent else return err
+*/
+func (h *Handler) ApproveCalledCountry(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ApproveCalledCountry is called...")
+
+	workspaceId, err := strconv.Atoi(c.FormValue("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	countryCode := strings.TrimPrefix(c.FormValue("country_code"), "+")
+	if _, err := strconv.Atoi(countryCode); err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid country_code")
+	}
+	if err := h.callStore.ApproveCalledCountry(workspaceId, countryCode); err != nil {
+		return utils.HandleInternalErr("ApproveCalledCountry error", err, c)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
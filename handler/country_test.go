@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"lineblocs.com/api/call"
+	"lineblocs.com/api/logger"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/user"
+)
+
+type fakeCountryCallStore struct {
+	call.Store
+	mu        sync.Mutex
+	countries map[string]*model.CalledCountry
+	emails    chan *model.CalledCountry
+}
+
+func (s *fakeCountryCallStore) GetCalledCountry(workspaceId int, countryCode string) (*model.CalledCountry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if country, ok := s.countries[countryCode]; ok {
+		return country, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeCountryCallStore) CheckIsMakingOutboundCallFirstTime(country *model.CalledCountry) (*model.CalledCountry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.countries[country.CountryCode]; ok {
+		return existing, false, nil
+	}
+	s.countries[country.CountryCode] = country
+	return country, true, nil
+}
+
+func (s *fakeCountryCallStore) SendNewDestinationEmail(workspace *model.Workspace, country *model.CalledCountry) error {
+	s.emails <- country
+	return nil
+}
+
+type fakeParamsUserStore struct {
+	user.Store
+	params []model.WorkspaceParam
+}
+
+func (s *fakeParamsUserStore) GetWorkspaceParams(workspaceId int) (*[]model.WorkspaceParam, error) {
+	return &s.params, nil
+}
+
+type fakeLoggerStore struct {
+	logger.Store
+	logs chan *model.LogRoutine
+}
+
+func (s *fakeLoggerStore) StartLogRoutine(workspace *model.Workspace, log *model.LogRoutine) (*string, error) {
+	s.logs <- log
+	id := "log"
+	return &id, nil
+}
+
+func TestCheckDestinationCountryRefused(t *testing.T) {
+	callStore := &fakeCountryCallStore{countries: make(map[string]*model.CalledCountry), emails: make(chan *model.CalledCountry, 2)}
+	loggerStore := &fakeLoggerStore{logs: make(chan *model.LogRoutine, 2)}
+	h := &Handler{
+		callStore:   callStore,
+		userStore:   &fakeParamsUserStore{params: []model.WorkspaceParam{{Key: blockNewHighRiskCountriesParam, Value: "true"}}},
+		loggerStore: loggerStore}
+	workspace := &model.Workspace{Id: 4, CreatorId: 9}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		_, allowed, err := h.checkDestinationCountry(workspace, &model.Call{To: "+5352123456"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed {
+			t.Fatalf("attempt %d to an unapproved high risk country was allowed", attempt)
+		}
+	}
+
+	country, ok := callStore.countries["53"]
+	if !ok {
+		t.Fatal("refused attempt was not recorded")
+	}
+	if country.Approved || !country.HighRisk || country.FirstNumber != "+5352123456" {
+		t.Errorf("recorded %+v, want a pending high risk country", country)
+	}
+
+	select {
+	case emailed := <-callStore.emails:
+		if emailed.CountryCode != "53" {
+			t.Errorf("email for country %s", emailed.CountryCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no first use email was sent")
+	}
+	select {
+	case log := <-loggerStore.logs:
+		if log.Level != "warning" {
+			t.Errorf("log level = %s, want warning", log.Level)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no debugger log was created")
+	}
+	select {
+	case <-callStore.emails:
+		t.Error("second refused attempt sent another email")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCheckDestinationCountryApproved(t *testing.T) {
+	callStore := &fakeCountryCallStore{
+		countries: map[string]*model.CalledCountry{"53": {WorkspaceId: 4, CountryCode: "53", HighRisk: true, Approved: true}},
+		emails:    make(chan *model.CalledCountry, 1)}
+	h := &Handler{
+		callStore: callStore,
+		userStore: &fakeParamsUserStore{params: []model.WorkspaceParam{{Key: blockNewHighRiskCountriesParam, Value: "true"}}}}
+
+	country, allowed, err := h.checkDestinationCountry(&model.Workspace{Id: 4}, &model.Call{To: "+5352123456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || country == nil || country.CountryCode != "53" {
+		t.Errorf("got %+v, %v, want the approved country to be allowed", country, allowed)
+	}
+}
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"encoding/csv"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/idempotency"
+	"lineblocs.com/api/metering"
 	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
@@ -26,29 +32,49 @@ func (h *Handler) CreateDebit(c echo.Context) error {
 		return utils.HandleInternalErr("CreateDebit 2 Could not decode JSON", err, c)
 	}
 
+	debit.IdempotencyKey = utils.GetIdempotencyKey(c, debit.IdempotencyKey)
+	debitId, found, err := h.lookupIdempotentRequest(c, idempotency.Debits, debit.WorkspaceId, debit.IdempotencyKey)
+	if err != nil {
+		return utils.HandleInternalErr("CreateDebit could not lookup idempotency key..", err, c)
+	}
+	if found {
+		c.Response().Writer.Header().Set("X-Debit-ID", strconv.FormatInt(debitId, 10))
+		return c.NoContent(http.StatusNoContent)
+	}
+
 	workspace, err := h.callStore.GetWorkspaceFromDB(debit.WorkspaceId)
 	if err != nil {
 		return utils.HandleInternalErr("Could not get workspace..", err, c)
 	}
 
-	// Get Call Rate depends number and type
-	rate := utils.LookupBestCallRate(debit.Number, debit.Type)
-	if rate == nil {
-		return c.NoContent(http.StatusNotFound)
+	// Get Call Rate depends number, type and plan
+	rate, err := h.ratingStore.LookupBestCallRate(workspace, debit.Number, debit.Type)
+	if err == utils.ErrNoCallRate {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("No call rate found for number %s, type %s", debit.Number, debit.Type))
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("CreateDebit could not lookup call rate..", err, c)
 	}
 	debit.PlanSnapshot = workspace.Plan
-	err = h.debitStore.CreateDebit(rate, &debit)
+	debitId, err = h.debitStore.CreateDebit(rate, &debit)
+	if err == utils.ErrIdempotencyConflict {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
 	if err != nil {
 		return utils.HandleInternalErr("CreateDebit Could not execute query..", err, c)
 	}
 
+	go h.checkBillingAlerts(workspace)
+
+	c.Response().Writer.Header().Set("X-Debit-ID", strconv.FormatInt(debitId, 10))
 	return c.NoContent(http.StatusNoContent)
 }
 
 /*
 Input: DebitAPI model
-Todo : Calculate cents based on debit type and create user_debit
-Output: If success return NoContent else return err
+Todo : Record the API usage in the usage ledger and create user_debit for the billable part
+Output: If success return NoContent, if the usage type is not metered return StatusBadRequest else return err
 */
 func (h *Handler) CreateAPIUsageDebit(c echo.Context) error {
 	utils.Log(logrus.InfoLevel, "CreateAPIUsageDebit is called...\r\n")
@@ -61,16 +87,200 @@ func (h *Handler) CreateAPIUsageDebit(c echo.Context) error {
 	if err := c.Validate(&debitApi); err != nil {
 		return utils.HandleInternalErr("CreateDebit 2 Could not decode JSON", err, c)
 	}
+
+	debitApi.IdempotencyKey = utils.GetIdempotencyKey(c, debitApi.IdempotencyKey)
+	debitId, found, err := h.lookupIdempotentRequest(c, idempotency.Debits, debitApi.WorkspaceId, debitApi.IdempotencyKey)
+	if err != nil {
+		return utils.HandleInternalErr("CreateAPIUsageDebit could not lookup idempotency key..", err, c)
+	}
+	if found {
+		c.Response().Writer.Header().Set("X-Debit-ID", strconv.FormatInt(debitId, 10))
+		return c.NoContent(http.StatusNoContent)
+	}
+
 	workspace, err := h.callStore.GetWorkspaceFromDB(debitApi.WorkspaceId)
 	if err != nil {
 		return utils.HandleInternalErr("Could not get workspace..", err, c)
 	}
 
-	err = h.debitStore.CreateAPIUsageDebit(workspace, &debitApi)
+	if _, err := metering.LookupUsageType(debitApi.Type); err != nil {
+		utils.Log(logrus.WarnLevel, err.Error())
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	quantity := metering.Quantity(&debitApi)
+	if quantity <= 0 {
+		return c.JSON(http.StatusBadRequest, "usage quantity must be greater than zero")
+	}
+
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("CreateAPIUsageDebit could not get plan..", err, c)
+	}
 
+	event := &model.UsageEvent{
+		UserId:         debitApi.UserId,
+		Type:           debitApi.Type,
+		Quantity:       quantity,
+		IdempotencyKey: debitApi.IdempotencyKey,
+	}
+	event, err = h.meteringStore.RecordUsage(workspace, plan, event)
+	if err == utils.ErrIdempotencyConflict {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
 	if err != nil {
 		return utils.HandleInternalErr("CreateDebit Could not execute query..", err, c)
 	}
 
+	go h.checkBillingAlerts(workspace)
+
+	c.Response().Writer.Header().Set("X-Debit-ID", strconv.FormatInt(event.DebitId, 10))
 	return c.NoContent(http.StatusNoContent)
 }
+
+/*
+Input: workspace_id, destination, direction, type
+Todo : Check the workspace can pay for a call before it is set up and work out how long it may last
+Output: If allowed return CallAuthorization model with the max duration in seconds,
+if the balance is exhausted return StatusPaymentRequired, else return err
+*/
+func (h *Handler) AuthorizeCall(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "AuthorizeCall is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	destination := c.QueryParam("destination")
+	direction := c.QueryParam("direction")
+	if direction != "inbound" && direction != "outbound" {
+		return c.JSON(http.StatusBadRequest, "direction must be inbound or outbound")
+	}
+
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("Could not get workspace..", err, c)
+	}
+
+	balance, err := h.debitStore.GetWorkspaceBalance(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("AuthorizeCall could not get balance..", err, c)
+	}
+	auth := &model.CallAuthorization{
+		WorkspaceId:  workspace.Id,
+		Destination:  destination,
+		Direction:    direction,
+		BalanceCents: balance}
+
+	if balance <= 0 {
+		auth.Reason = "balance exhausted"
+		return c.JSON(http.StatusPaymentRequired, &auth)
+	}
+
+	rate, err := h.ratingStore.LookupBestCallRate(workspace, destination, c.QueryParam("type"))
+	if err == utils.ErrNoCallRate && direction == "inbound" {
+		// inbound calls without a rate are not billed per minute
+		auth.Allowed = true
+		auth.MaxDuration = utils.MaxCallDuration
+		return c.JSON(http.StatusOK, &auth)
+	}
+	if err == utils.ErrNoCallRate {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("AuthorizeCall could not lookup call rate..", err, c)
+	}
+
+	auth.Rate = rate
+	auth.MaxDuration = utils.CalculateMaxDuration(balance, rate)
+	if auth.MaxDuration == 0 {
+		auth.Reason = "balance too low for the first billing increment"
+		return c.JSON(http.StatusPaymentRequired, &auth)
+	}
+	auth.Allowed = true
+	return c.JSON(http.StatusOK, &auth)
+}
+
+/*
+Input: workspace_id, period (YYYY-MM, defaults to the current month), format (json or csv)
+Todo : Summarize the workspace debits of the billing period by source and preview the invoice with the plan base fee
+Output: If success return UsageSummary model as JSON or CSV else return err
+*/
+func (h *Handler) GetUsageSummary(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetUsageSummary is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	start, end, err := utils.GetBillingPeriod(c.QueryParam("period"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, "format must be json or csv")
+	}
+
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetUsageSummary could not get workspace..", err, c)
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("GetUsageSummary could not get plan..", err, c)
+	}
+	lines, err := h.debitStore.GetUsageSummary(workspace, start, end)
+	if err != nil {
+		return utils.HandleInternalErr("GetUsageSummary could not execute query..", err, c)
+	}
+
+	summary := &model.UsageSummary{
+		WorkspaceId:  workspace.Id,
+		Plan:         plan.Name,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		Lines:        lines,
+		BaseFeeCents: utils.ToPreciseCents(plan.MonthlyFee)}
+	for _, line := range lines {
+		summary.UsageCents += line.Cents
+	}
+	summary.TotalCents = summary.BaseFeeCents + summary.UsageCents
+	summary.ProjectedUsageCents = utils.ProjectPeriodUsage(summary.UsageCents, start, end, time.Now())
+	summary.ProjectedTotalCents = summary.BaseFeeCents + summary.ProjectedUsageCents
+
+	if format == "csv" {
+		return writeUsageSummaryCSV(c, summary)
+	}
+	return c.JSON(http.StatusOK, &summary)
+}
+
+func writeUsageSummaryCSV(c echo.Context, summary *model.UsageSummary) error {
+	filename := fmt.Sprintf("usage-%d-%s.csv", summary.WorkspaceId, summary.PeriodStart.Format("2006-01"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	cents := func(value float64) string { return strconv.FormatFloat(value, 'f', 4, 64) }
+	w := csv.NewWriter(c.Response())
+	records := [][]string{{"category", "source", "direction", "usage_type", "count", "seconds", "billable_seconds", "quantity", "cents"}}
+	for _, line := range summary.Lines {
+		records = append(records, []string{
+			line.Category,
+			line.Source,
+			line.Direction,
+			line.UsageType,
+			strconv.Itoa(line.Count),
+			strconv.FormatFloat(line.Seconds, 'f', -1, 64),
+			strconv.Itoa(line.BillableSeconds),
+			strconv.FormatFloat(line.Quantity, 'f', -1, 64),
+			cents(line.Cents)})
+	}
+	records = append(records,
+		[]string{"plan", summary.Plan, "", "", "", "", "", "", cents(summary.BaseFeeCents)},
+		[]string{"total", "", "", "", "", "", "", "", cents(summary.TotalCents)},
+		[]string{"projected_total", "", "", "", "", "", "", "", cents(summary.ProjectedTotalCents)})
+	return w.WriteAll(records)
+}
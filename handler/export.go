@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+// Columns of a CDR export in their default order
+var cdrColumns = []string{"id", "api_id", "from", "to", "direction", "status", "started_at", "ringing_at", "answered_at", "ended_at",
+	"duration", "billable_duration", "hangup_cause", "sip_status", "provider_id", "cost"}
+
+type cdrRow struct {
+	call  *model.Call
+	cents float64
+	loc   *time.Location
+}
+
+func (r *cdrRow) value(column string) interface{} {
+	switch column {
+	case "id":
+		return r.call.Id
+	case "api_id":
+		return r.call.APIId
+	case "from":
+		return r.call.From
+	case "to":
+		return r.call.To
+	case "direction":
+		return r.call.Direction
+	case "status":
+		return r.call.Status
+	case "started_at":
+		return r.convertTime(&r.call.StartedAt)
+	case "ringing_at":
+		return r.convertTime(r.call.RingingAt)
+	case "answered_at":
+		return r.convertTime(r.call.AnsweredAt)
+	case "ended_at":
+		return r.convertTime(r.call.EndedAt)
+	case "duration":
+		return r.call.Duration
+	case "billable_duration":
+		return r.call.BillableDuration
+	case "hangup_cause":
+		return r.call.HangupCause
+	case "sip_status":
+		return r.call.SIPStatus
+	case "provider_id":
+		return r.call.ProviderId
+	case "cost":
+		// cents are kept with sub-cent precision, exports show dollars
+		return r.cents / 100
+	}
+	return nil
+}
+
+func (r *cdrRow) convertTime(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return *value
+	}
+	return t.In(r.loc).Format(time.RFC3339)
+}
+
+/*
+Input: workspace_id, start_date, end_date, format (csv or jsonl), columns (comma separated), timezone (IANA name)
+Todo : Stream the call detail records of a workspace in the date range with their rated cost, one row at a time
+Output: If success stream CSV or JSON Lines else return err
+*/
+func (h *Handler) ExportCalls(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ExportCalls is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	start, err := utils.ParseDateTime(c.QueryParam("start_date"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid start_date")
+	}
+	end, err := utils.ParseDateTime(c.QueryParam("end_date"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid end_date")
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		return c.JSON(http.StatusBadRequest, "format must be csv or jsonl")
+	}
+	loc := time.UTC
+	if tz := c.QueryParam("timezone"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid timezone")
+		}
+	}
+	columns, err := getCDRColumns(c.QueryParam("columns"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	filter := &model.CallFilter{
+		WorkspaceId: workspaceId,
+		StartedFrom: &start,
+		StartedTo:   &end}
+
+	res := c.Response()
+	filename := fmt.Sprintf("cdr-%d-%s-%s.%s", workspaceId, start.Format("20060102"), end.Format("20060102"), format)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+
+	var write func(*cdrRow) error
+	if format == "csv" {
+		res.Header().Set(echo.HeaderContentType, "text/csv")
+		w := csv.NewWriter(res)
+		write = func(row *cdrRow) error {
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				if value := row.value(column); value != nil {
+					record[i] = fmt.Sprint(value)
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+			w.Flush()
+			return w.Error()
+		}
+		res.WriteHeader(http.StatusOK)
+		// the header row is sent even when no call matches
+		if err := w.Write(columns); err != nil {
+			return err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	} else {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		enc := json.NewEncoder(res)
+		write = func(row *cdrRow) error {
+			record := make(map[string]interface{}, len(columns))
+			for _, column := range columns {
+				record[column] = row.value(column)
+			}
+			return enc.Encode(record)
+		}
+		res.WriteHeader(http.StatusOK)
+	}
+
+	err = h.callStore.ExportCalls(filter, func(call *model.Call, cents float64) error {
+		if err := write(&cdrRow{call: call, cents: cents, loc: loc}); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	})
+	if err != nil {
+		// headers are already sent, the client sees a truncated export
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("ExportCalls stopped: %s", err.Error()))
+	}
+	return nil
+}
+
+func getCDRColumns(value string) ([]string, error) {
+	if value == "" {
+		return cdrColumns, nil
+	}
+	columns := strings.Split(value, ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+		known := false
+		for _, cdrColumn := range cdrColumns {
+			if columns[i] == cdrColumn {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.New("unknown column " + columns[i])
+		}
+	}
+	return columns, nil
+}
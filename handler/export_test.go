@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"lineblocs.com/api/call"
+	"lineblocs.com/api/model"
+)
+
+func TestGetCDRColumns(t *testing.T) {
+	columns, err := getCDRColumns("")
+	if err != nil || !reflect.DeepEqual(columns, cdrColumns) {
+		t.Errorf("getCDRColumns(\"\") = %v, %v, want default columns", columns, err)
+	}
+	columns, err = getCDRColumns("id, cost ,to")
+	if err != nil || !reflect.DeepEqual(columns, []string{"id", "cost", "to"}) {
+		t.Errorf("getCDRColumns = %v, %v, want [id cost to]", columns, err)
+	}
+	if _, err := getCDRColumns("id,password"); err == nil {
+		t.Error("getCDRColumns accepted an unknown column")
+	}
+}
+
+func TestCDRRowValue(t *testing.T) {
+	loc, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip("timezone database unavailable")
+	}
+	row := &cdrRow{
+		call:  &model.Call{Id: 7, StartedAt: "2026-10-01T16:00:00Z"},
+		cents: 1234.5,
+		loc:   loc,
+	}
+	if got := row.value("started_at"); got != "2026-10-01T12:00:00-04:00" {
+		t.Errorf("started_at = %v, want local time", got)
+	}
+	if got := row.value("answered_at"); got != nil {
+		t.Errorf("answered_at = %v, want nil", got)
+	}
+	if got := row.value("cost"); got != 12.345 {
+		t.Errorf("cost = %v, want 12.345", got)
+	}
+}
+
+type fakeExportCallStore struct {
+	call.Store
+	calls []*model.Call
+}
+
+func (s *fakeExportCallStore) ExportCalls(filter *model.CallFilter, each func(*model.Call, float64) error) error {
+	for _, c := range s.calls {
+		if err := each(c, 150); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportCallsCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []*model.Call
+		want  string
+	}{
+		{"no calls", nil, "id,to,cost\n"},
+		{"one call", []*model.Call{{Id: 7, To: "+14165550100"}}, "id,to,cost\n7,+14165550100,1.5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{callStore: &fakeExportCallStore{calls: tt.calls}}
+			req := httptest.NewRequest(http.MethodGet, "/call/exportCalls?workspace_id=1&start_date=2026-10-01&end_date=2026-11-01&columns=id,to,cost", nil)
+			rec := httptest.NewRecorder()
+			if err := h.ExportCalls(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("ExportCalls: %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,19 +3,20 @@ package handler
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/idempotency"
 	"lineblocs.com/api/model"
+	"lineblocs.com/api/storage"
 	"lineblocs.com/api/utils"
 )
 
 /*
 Input: file, user_id, workspace_id, call_id, name
-Todo : Create fax and store to db, also upload file to AWS s3
-Output: If success return Fax model with fax id in header else return err
+Todo : Upload the fax file to the storage of the workspace and store the fax to db
+Output: If success return Fax model with fax id in header, if the plan fax limit is reached return NoContent else return err
 */
 func (h *Handler) CreateFax(c echo.Context) error {
 	utils.Log(logrus.InfoLevel, "CreateFax is called...")
@@ -27,11 +28,6 @@ func (h *Handler) CreateFax(c echo.Context) error {
 		return utils.HandleInternalErr("CreateFax error occured", err, c)
 	}
 
-	workspace, err := h.callStore.GetWorkspaceFromDB(fax.WorkspaceId)
-	if err != nil {
-		return utils.HandleInternalErr("Could not get workspace..", err, c)
-	}
-
 	userId := c.FormValue("user_id")
 	userIdInt, err := strconv.Atoi(userId)
 	if err != nil {
@@ -44,6 +40,11 @@ func (h *Handler) CreateFax(c echo.Context) error {
 		return utils.HandleInternalErr("CreateFax error occured workspace ID", err, c)
 	}
 
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceIdInt)
+	if err != nil {
+		return utils.HandleInternalErr("Could not get workspace..", err, c)
+	}
+
 	callId := c.FormValue("call_id")
 	callIdInt, err := strconv.Atoi(callId)
 	if err != nil {
@@ -52,45 +53,66 @@ func (h *Handler) CreateFax(c echo.Context) error {
 
 	name := c.FormValue("name")
 
-	src, err := file.Open()
+	idempotencyKey := utils.GetIdempotencyKey(c, c.FormValue("idempotency_key"))
+	existingId, found, err := h.lookupIdempotentRequest(c, idempotency.Faxes, workspaceIdInt, idempotencyKey)
 	if err != nil {
-		return utils.HandleInternalErr("CreateFax error occured", err, c)
+		return utils.HandleInternalErr("CreateFax could not lookup idempotency key..", err, c)
+	}
+	if found {
+		existing, err := h.faxStore.GetFaxFromDB(int(existingId))
+		if err != nil {
+			return utils.HandleInternalErr("CreateFax could not get fax..", err, c)
+		}
+		if conflict, err := replayConflict(c, workspaceIdInt, existing.WorkspaceId); conflict {
+			return err
+		}
+		c.Response().Writer.Header().Set("X-Fax-ID", strconv.FormatInt(existingId, 10))
+		return c.JSON(http.StatusOK, &existing)
 	}
-	defer src.Close()
 
-	dst, err := os.OpenFile(file.Filename, os.O_WRONLY|os.O_CREATE, 0666)
+	// Get fax count limit and check current count is over the limit
+	count, err := h.faxStore.GetFaxCount(workspaceIdInt)
 	if err != nil {
 		return utils.HandleInternalErr("CreateFax error occured", err, c)
 	}
-	defer dst.Close()
-	apiId := utils.CreateAPIID("fax")
-	uri := utils.CreateS3URL("faxes", apiId)
-	count, err := h.faxStore.GetFaxCount(workspaceIdInt)
+	plan, err := h.planStore.GetPlan(workspace)
 	if err != nil {
 		return utils.HandleInternalErr("CreateFax error occured", err, c)
 	}
+	newCount := (*count) + 1
+	if !utils.WithinPlanLimit(plan.FaxLimit, newCount) {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Not saving fax due to limit reached.."))
+		return c.NoContent(http.StatusNoContent)
+	}
 
-	fax = &model.Fax{UserId: userIdInt, WorkspaceId: workspaceIdInt, CallId: callIdInt, Uri: uri}
-
-	faxId, err := h.faxStore.CreateFax(fax, name, file.Size, apiId, workspace.Plan)
-
+	src, err := file.Open()
 	if err != nil {
 		return utils.HandleInternalErr("CreateFax error occured", err, c)
 	}
+	defer src.Close()
 
-	// Get fax count limit and check current count is over the limit
-	limit, err := utils.GetPlanFaxLimit(workspace)
+	// Upload fax file before it is stored so the uri never points to a missing object
+	backend, err := h.getStorage(workspace)
 	if err != nil {
-		return utils.HandleInternalErr("CreateFax error occured", err, c)
+		return utils.HandleInternalErr("CreateFax could not get storage..", err, c)
 	}
-	newCount := (*count) + 1
-	if newCount > *limit {
-		utils.Log(logrus.WarnLevel, fmt.Sprintf("Not saving fax due to limit reached.."))
-		return c.NoContent(http.StatusNoContent)
+	apiId := utils.CreateAPIID("fax")
+	key := storage.Key(storage.FaxesFolder, apiId)
+	err = backend.Upload(c.Request().Context(), key, src, file.Header.Get(echo.HeaderContentType), "")
+	if err != nil {
+		return utils.HandleInternalErr("CreateFax could not upload file..", err, c)
 	}
 
-	// Upload fax file to AWS s3
-	go utils.UploadS3("faxes", apiId, src)
+	location := backend.Location()
+	fax = &model.Fax{UserId: userIdInt, WorkspaceId: workspaceIdInt, CallId: callIdInt, Uri: backend.URI(key), APIId: apiId, Location: &location, IdempotencyKey: idempotencyKey}
+
+	faxId, err := h.faxStore.CreateFax(fax, name, file.Size, apiId, workspace.Plan)
+	if err == utils.ErrIdempotencyConflict {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("CreateFax error occured", err, c)
+	}
 
 	c.Response().Writer.Header().Set("X-Fax-ID", strconv.FormatInt(faxId, 10))
 	return c.JSON(http.StatusOK, &fax)
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/fraud"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+// Page size of fraud decision listings
+const (
+	defaultFraudDecisionLimit = 50
+	maxFraudDecisionLimit     = 500
+)
+
+/*
+Input: Workspace model, Call model
+Todo : Run the fraud rules against an outbound call, log the decision when a rule triggered,
+alert the workspace owner and suspend the workspace when the score is too high
+Output: First Value: FraudDecision model, Second Value: error
+*/
+func (h *Handler) checkFraud(workspace *model.Workspace, call *model.Call) (*model.FraudDecision, error) {
+	check := &model.FraudCheck{
+		WorkspaceId: workspace.Id,
+		CallAPIId:   call.APIId,
+		Extension:   call.From,
+		Destination: call.To,
+		At:          time.Now()}
+	rules, err := h.fraudStore.GetRules(workspace.Id)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := h.fraudStore.GetActivity(check)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := fraud.Evaluate(rules, check, activity)
+	if decision.Action == fraud.ActionAllow {
+		return decision, nil
+	}
+
+	if fraud.ShouldSuspend(decision, getSuspendScore()) {
+		reason := fmt.Sprintf("fraud score %d on call to %s: %s", decision.Score, call.To, strings.Join(decision.Reasons, "; "))
+		decision.Suspended, err = h.fraudStore.SuspendWorkspace(workspace.Id, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	utils.Log(logrus.WarnLevel, fmt.Sprintf("Fraud decision %s for workspace %d call %s, score %d: %s",
+		decision.Action, workspace.Id, call.APIId, decision.Score, strings.Join(decision.Reasons, "; ")))
+	if err := h.fraudStore.LogDecision(decision); err != nil {
+		return nil, err
+	}
+
+	if decision.Action != fraud.ActionScore || decision.Suspended {
+		go h.sendFraudAlert(workspace, decision)
+	}
+	return decision, nil
+}
+
+func (h *Handler) sendFraudAlert(workspace *model.Workspace, decision *model.FraudDecision) {
+	title := "Suspicious outbound call"
+	level := "warning"
+	if decision.Action == fraud.ActionBlock {
+		title = "Outbound call blocked"
+	}
+	if decision.Suspended {
+		title = "Workspace suspended for suspected fraud"
+		level = "error"
+	}
+	log := &model.LogRoutine{
+		From:        decision.Extension,
+		To:          decision.Destination,
+		Level:       level,
+		Title:       title,
+		Report:      fmt.Sprintf("Fraud score %d: %s", decision.Score, strings.Join(decision.Reasons, "; ")),
+		UserId:      workspace.CreatorId,
+		WorkspaceId: workspace.Id}
+	_, err := h.loggerStore.StartLogRoutine(workspace, log)
+	if err != nil {
+		utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not send fraud alert: %s", err.Error()))
+	}
+}
+
+func getSuspendScore() int {
+	value := utils.Config("FRAUD_SUSPEND_SCORE")
+	if value == "" {
+		return fraud.DefaultSuspendScore
+	}
+	score, err := strconv.Atoi(value)
+	if err != nil {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Invalid FRAUD_SUSPEND_SCORE %q", value))
+		return fraud.DefaultSuspendScore
+	}
+	return score
+}
+
+// Write the response refusing calls of a suspended workspace
+func workspaceSuspended(c echo.Context, suspension *model.WorkspaceSuspension) error {
+	utils.Log(logrus.WarnLevel, fmt.Sprintf("Refusing call of suspended workspace %d", suspension.WorkspaceId))
+	return c.JSON(http.StatusForbidden, "workspace is suspended: "+suspension.Reason)
+}
+
+/*
+Input: workspace_id, limit (optional)
+Todo : Get the latest fraud decisions of the workspace
+Output: If success return list of FraudDecision model else return err
+*/
+func (h *Handler) GetFraudDecisions(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetFraudDecisions is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	limit := defaultFraudDecisionLimit
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxFraudDecisionLimit {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxFraudDecisionLimit))
+		}
+	}
+
+	decisions, err := h.fraudStore.GetDecisions(workspaceId, limit)
+	if err != nil {
+		return utils.HandleInternalErr("GetFraudDecisions error", err, c)
+	}
+	return c.JSON(http.StatusOK, &decisions)
+}
+
+/*
+Input: workspace_id
+Todo : Get the active suspension of the workspace
+Output: If suspended return WorkspaceSuspension model, if not suspended return StatusNotFound else return err
+*/
+func (h *Handler) GetWorkspaceSuspension(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetWorkspaceSuspension is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	suspension, err := h.fraudStore.GetSuspension(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetWorkspaceSuspension error", err, c)
+	}
+	if suspension == nil {
+		return c.JSON(http.StatusNotFound, "workspace is not suspended")
+	}
+	return c.JSON(http.StatusOK, &suspension)
+}
+
+/*
+Input: workspace_id
+Todo : Lift the active suspension of the workspace so it can place calls again
+Output: If success return NoContent, if not suspended return StatusNotFound else return err
+*/
+func (h *Handler) LiftWorkspaceSuspension(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "LiftWorkspaceSuspension is called...")
+
+	workspaceId, err := strconv.Atoi(c.FormValue("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	lifted, err := h.fraudStore.LiftSuspension(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("LiftWorkspaceSuspension error", err, c)
+	}
+	if !lifted {
+		return c.JSON(http.StatusNotFound, "workspace is not suspended")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -4,10 +4,18 @@ import (
 	"lineblocs.com/api/admin"
 	"lineblocs.com/api/call"
 	"lineblocs.com/api/carrier"
+	"lineblocs.com/api/conference"
 	"lineblocs.com/api/debit"
 	"lineblocs.com/api/fax"
+	"lineblocs.com/api/fraud"
+	"lineblocs.com/api/idempotency"
 	"lineblocs.com/api/logger"
+	"lineblocs.com/api/metering"
+	"lineblocs.com/api/plan"
+	"lineblocs.com/api/quality"
+	"lineblocs.com/api/rating"
 	"lineblocs.com/api/recording"
+	"lineblocs.com/api/storage"
 	"lineblocs.com/api/user"
 )
 
@@ -17,25 +25,43 @@ You can add new service here.
 */
 
 type Handler struct {
-	adminStore     admin.Store
-	callStore      call.Store
-	carrierStore   carrier.Store
-	debitStore     debit.Store
-	faxStore       fax.Store
-	loggerStore    logger.Store
-	recordingStore recording.Store
-	userStore      user.Store
+	adminStore       admin.Store
+	callStore        call.Store
+	carrierStore     carrier.Store
+	conferenceStore  conference.Store
+	debitStore       debit.Store
+	faxStore         fax.Store
+	fraudStore       fraud.Store
+	idempotencyStore idempotency.Store
+	loggerStore      logger.Store
+	meteringStore    metering.Store
+	planStore        plan.Store
+	qualityStore     quality.Store
+	ratingStore      rating.Store
+	recordingStore   recording.Store
+	userStore        user.Store
+	callTracker      *call.Tracker
+	storage          *storage.Provider
 }
 
-func NewHandler(as admin.Store, cs call.Store, crs carrier.Store, ds debit.Store, fs fax.Store, ls logger.Store, rs recording.Store, us user.Store) *Handler {
+func NewHandler(as admin.Store, cs call.Store, crs carrier.Store, cfs conference.Store, ds debit.Store, fs fax.Store, frs fraud.Store, is idempotency.Store, ls logger.Store, ms metering.Store, ps plan.Store, qs quality.Store, rts rating.Store, rs recording.Store, us user.Store, ct *call.Tracker, sp *storage.Provider) *Handler {
 	return &Handler{
-		adminStore:     as,
-		callStore:      cs,
-		carrierStore:   crs,
-		debitStore:     ds,
-		faxStore:       fs,
-		loggerStore:    ls,
-		recordingStore: rs,
-		userStore:      us,
+		adminStore:       as,
+		callStore:        cs,
+		carrierStore:     crs,
+		conferenceStore:  cfs,
+		debitStore:       ds,
+		faxStore:         fs,
+		fraudStore:       frs,
+		idempotencyStore: is,
+		loggerStore:      ls,
+		meteringStore:    ms,
+		planStore:        ps,
+		qualityStore:     qs,
+		ratingStore:      rts,
+		recordingStore:   rs,
+		userStore:        us,
+		callTracker:      ct,
+		storage:          sp,
 	}
 }
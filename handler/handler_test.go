@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"os"
+	"testing"
+
+	"lineblocs.com/api/utils"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("USE_DOTENV", "off")
+	utils.InitLogrus()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: echo context, table, workspace id, idempotency key
+Todo : Look up the row created by an earlier request of the workspace with the same idempotency key and flag the response as a replay
+Output: First Value: id of the row, Second Value: found, Third Value: error
+*/
+func (h *Handler) lookupIdempotentRequest(c echo.Context, table string, workspaceId int, key string) (int64, bool, error) {
+	if key == "" {
+		return 0, false, nil
+	}
+	id, err := h.idempotencyStore.LookupIdempotencyKey(table, workspaceId, key)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	utils.Log(logrus.InfoLevel, fmt.Sprintf("Replaying request with idempotency key %s", key))
+	c.Response().Header().Set(utils.HeaderIdempotentReplay, "true")
+	return id, true, nil
+}
+
+/*
+Input: echo context, workspace id of the request, workspace id of the replayed row
+Todo : Refuse to replay a row created by another workspace
+Output: true and the StatusConflict response when the row belongs to another workspace
+*/
+func replayConflict(c echo.Context, workspaceId int, ownerId int) (bool, error) {
+	if workspaceId == ownerId {
+		return false, nil
+	}
+	utils.Log(logrus.WarnLevel, fmt.Sprintf("Refusing to replay a row of workspace %d to workspace %d", ownerId, workspaceId))
+	c.Response().Header().Del(utils.HeaderIdempotentReplay)
+	return true, c.JSON(http.StatusConflict, utils.ErrIdempotencyConflict.Error())
+}
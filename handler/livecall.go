@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	callstate "lineblocs.com/api/call"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: workspace_id, media_server_ip, provider_id (all optional)
+Todo : List the calls in progress with their elapsed time and whether a hangup was requested
+Output: If success return list of LiveCall model else return err
+*/
+func (h *Handler) ListLiveCalls(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ListLiveCalls is called...")
+
+	var err error
+	filter := &model.LiveCallFilter{MediaServerIp: c.QueryParam("media_server_ip")}
+	if value := c.QueryParam("workspace_id"); value != "" {
+		filter.WorkspaceId, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+		}
+	}
+	if value := c.QueryParam("provider_id"); value != "" {
+		filter.ProviderId, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid provider_id")
+		}
+	}
+
+	calls, err := h.callStore.ListLiveCalls(filter, h.callTracker.TTL())
+	if err != nil {
+		return utils.HandleInternalErr("ListLiveCalls could not execute query..", err, c)
+	}
+	for _, call := range calls {
+		call.Tracked = h.callTracker.Has(call.WorkspaceId, call.APIId)
+	}
+	return c.JSON(http.StatusOK, &calls)
+}
+
+/*
+Input: call_id, reason, requested_by
+Todo : Queue a forced hangup for a call in progress, the media server handling the call picks it up by polling
+Output: If success return CallCommand model, if the call already ended return StatusConflict else return err
+*/
+func (h *Handler) RequestHangup(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "RequestHangup is called...")
+
+	callId, err := strconv.Atoi(c.FormValue("call_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid call_id")
+	}
+	call, err := h.callStore.GetCallFromDB(callId)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("RequestHangup could not get call..", err, c)
+	}
+	if callstate.IsTerminal(call.Status) {
+		return c.JSON(http.StatusConflict, "call already "+call.Status)
+	}
+
+	command := &model.CallCommand{
+		CallId:        call.Id,
+		CallAPIId:     call.APIId,
+		WorkspaceId:   call.WorkspaceId,
+		MediaServerIp: call.MediaServerIp,
+		Command:       model.CallCommandHangup,
+		Reason:        c.FormValue("reason"),
+		RequestedBy:   c.FormValue("requested_by")}
+	command, err = h.callStore.CreateCallCommand(command)
+	if err != nil {
+		return utils.HandleInternalErr("RequestHangup could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &command)
+}
+
+/*
+Input: media_server_ip, defaults to the address of the caller
+Todo : Get the commands pending for calls on a media server
+Output: If success return list of CallCommand model else return err
+*/
+func (h *Handler) GetPendingCallCommands(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetPendingCallCommands is called...")
+
+	mediaServerIp := c.QueryParam("media_server_ip")
+	if mediaServerIp == "" {
+		mediaServerIp = c.RealIP()
+	}
+	commands, err := h.callStore.GetPendingCallCommands(mediaServerIp)
+	if err != nil {
+		return utils.HandleInternalErr("GetPendingCallCommands could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &commands)
+}
+
+/*
+Input: command_id, media_server_ip (defaults to the address of the caller)
+Todo : Acknowledge a command picked up by a media server so it is not handed out again
+Output: If success return NoContent, if no pending command matches return StatusNotFound else return err
+*/
+func (h *Handler) AcknowledgeCallCommand(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "AcknowledgeCallCommand is called...")
+
+	commandId, err := strconv.Atoi(c.FormValue("command_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid command_id")
+	}
+	mediaServerIp := c.FormValue("media_server_ip")
+	if mediaServerIp == "" {
+		mediaServerIp = c.RealIP()
+	}
+	acknowledged, err := h.callStore.AcknowledgeCallCommand(commandId, mediaServerIp)
+	if err != nil {
+		return utils.HandleInternalErr("AcknowledgeCallCommand could not execute query..", err, c)
+	}
+	if !acknowledged {
+		return c.JSON(http.StatusNotFound, "no pending command found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
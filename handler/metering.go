@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: workspace_id
+Todo : Get the metered usage types with the unit prices of the workspace plan
+Output: If success return list of UsageType model else return err
+*/
+func (h *Handler) GetUsageTypes(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetUsageTypes is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetUsageTypes could not get workspace..", err, c)
+	}
+	types, err := h.meteringStore.GetUsageTypes(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("GetUsageTypes could not get prices..", err, c)
+	}
+	return c.JSON(http.StatusOK, &types)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: workspace_id
+Todo : Get the plan definition for the workspace
+Output: If success return Plan model else return err
+*/
+func (h *Handler) GetPlan(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetPlan is called...")
+
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid workspace_id")
+	}
+	workspace, err := h.callStore.GetWorkspaceFromDB(workspaceId)
+	if err != nil {
+		return utils.HandleInternalErr("GetPlan could not get workspace..", err, c)
+	}
+	plan, err := h.planStore.GetPlan(workspace)
+	if errors.Is(err, utils.ErrUnknownPlan) {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("GetPlan could not get plan..", err, c)
+	}
+	return c.JSON(http.StatusOK, &plan)
+}
+
+/*
+Todo : Get every plan definition
+Output: If success return list of Plan model else return err
+*/
+func (h *Handler) GetPlans(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetPlans is called...")
+
+	plans, err := h.planStore.GetPlans()
+	if err != nil {
+		return utils.HandleInternalErr("GetPlans could not get plans..", err, c)
+	}
+	return c.JSON(http.StatusOK, &plans)
+}
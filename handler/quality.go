@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/quality"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: QualityReport model
+Todo : Store the RTP stats a media server measured for a call leg at hangup
+Output: If success return NoContent with the report id in header else return err
+*/
+func (h *Handler) CreateQualityReport(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "CreateQualityReport is called...")
+
+	var report model.QualityReport
+	if err := c.Bind(&report); err != nil {
+		return utils.HandleInternalErr("CreateQualityReport 1 Could not decode JSON", err, c)
+	}
+	if err := c.Validate(&report); err != nil {
+		return utils.HandleInternalErr("CreateQualityReport 2 Could not decode JSON", err, c)
+	}
+	if report.CallAPIId == "" {
+		return c.JSON(http.StatusBadRequest, "call_api_id is required")
+	}
+	if report.MOS < 1 || report.MOS > 5 || report.PacketLossPct < 0 || report.PacketLossPct > 100 || report.JitterMs < 0 || report.RTTMs < 0 {
+		return c.JSON(http.StatusBadRequest, "quality metrics out of range")
+	}
+	if report.MediaServerIp == "" {
+		report.MediaServerIp = c.RealIP()
+	}
+
+	reportId, err := h.qualityStore.CreateQualityReport(&report)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "call not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("CreateQualityReport could not execute query..", err, c)
+	}
+	c.Response().Writer.Header().Set("X-Quality-Report-ID", strconv.FormatInt(reportId, 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+/*
+Input: call_api_id
+Todo : Get the quality reports of every leg of a call
+Output: If success return list of QualityReport model else return err
+*/
+func (h *Handler) GetQualityReports(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetQualityReports is called...")
+
+	reports, err := h.qualityStore.GetQualityReports(c.QueryParam("call_api_id"))
+	if err != nil {
+		return utils.HandleInternalErr("GetQualityReports could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &reports)
+}
+
+/*
+Input: group_by (provider or media_server), start_date, end_date (defaults to the last 24 hours)
+Todo : Aggregate call quality per provider or media server to spot bad routes
+Output: If success return list of QualityStats model else return err
+*/
+func (h *Handler) GetQualityStats(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetQualityStats is called...")
+
+	groupBy := c.QueryParam("group_by")
+	if groupBy == "" {
+		groupBy = quality.GroupByProvider
+	}
+	if groupBy != quality.GroupByProvider && groupBy != quality.GroupByMediaServer {
+		return c.JSON(http.StatusBadRequest, "group_by must be provider or media_server")
+	}
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	var err error
+	if value := c.QueryParam("start_date"); value != "" {
+		start, err = utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid start_date")
+		}
+	}
+	if value := c.QueryParam("end_date"); value != "" {
+		end, err = utils.ParseDateTime(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid end_date")
+		}
+	}
+
+	stats, err := h.qualityStore.GetQualityStats(groupBy, start, end)
+	if err != nil {
+		return utils.HandleInternalErr("GetQualityStats could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &stats)
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/quality"
+	"lineblocs.com/api/router"
+)
+
+type fakeQualityStore struct {
+	quality.Store
+	created []*model.QualityReport
+}
+
+func (s *fakeQualityStore) CreateQualityReport(report *model.QualityReport) (int64, error) {
+	if report.CallAPIId == "missing" {
+		return -1, sql.ErrNoRows
+	}
+	s.created = append(s.created, report)
+	return int64(len(s.created)), nil
+}
+
+func TestCreateQualityReport(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"call_api_id":"abc","leg":"caller","mos":4.1,"jitter_ms":3,"packet_loss_pct":0.5}`, http.StatusNoContent},
+		{"missing call", `{"call_api_id":"","mos":4.1}`, http.StatusBadRequest},
+		{"mos out of range", `{"call_api_id":"abc","mos":5.5}`, http.StatusBadRequest},
+		{"negative packet loss", `{"call_api_id":"abc","mos":4,"packet_loss_pct":-1}`, http.StatusBadRequest},
+		{"unknown call", `{"call_api_id":"missing","mos":4}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeQualityStore{}
+			h := &Handler{qualityStore: store}
+			e := echo.New()
+			e.Validator = router.NewValidator()
+			req := httptest.NewRequest(http.MethodPost, "/call/createQualityReport", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = "10.0.0.5:5060"
+			rec := httptest.NewRecorder()
+			if err := h.CreateQualityReport(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("CreateQualityReport: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusNoContent && store.created[0].MediaServerIp != "10.0.0.5" {
+				t.Errorf("media server ip = %q, want the caller address", store.created[0].MediaServerIp)
+			}
+		})
+	}
+}
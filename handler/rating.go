@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Input: file, provider_id, name
+Todo : Parse a CSV rate deck (prefix, country, rate, effective date), validate it and store it as versions
+Output: If success return RateDeckImport model with the created versions and validation warnings else return validation problems or err
+*/
+func (h *Handler) ImportRateDeck(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "ImportRateDeck is called...")
+
+	providerId, err := strconv.Atoi(c.FormValue("provider_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid provider_id")
+	}
+	name := c.FormValue("name")
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "file is required")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return utils.HandleInternalErr("ImportRateDeck could not open file", err, c)
+	}
+	defer src.Close()
+
+	entries, err := utils.ParseRateDeckCSV(src)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	problems, warnings := utils.ValidateRateDeck(entries)
+	if len(problems) != 0 {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Rate deck for provider %d has %d problems", providerId, len(problems)))
+		return c.JSON(http.StatusBadRequest, problems)
+	}
+	if len(warnings) != 0 {
+		utils.Log(logrus.InfoLevel, fmt.Sprintf("Rate deck for provider %d has %d warnings", providerId, len(warnings)))
+	}
+
+	decks, err := h.ratingStore.ImportRateDeck(providerId, name, entries)
+	if errors.Is(err, utils.ErrRateDeckExists) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.HandleInternalErr("ImportRateDeck could not execute query..", err, c)
+	}
+	return c.JSON(http.StatusOK, &model.RateDeckImport{Decks: decks, Warnings: warnings})
+}
+
+/*
+Input: provider_id
+Todo : Get all rate deck versions of a provider
+Output: If success return RateDeck models else return err
+*/
+func (h *Handler) GetRateDecks(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetRateDecks is called...")
+
+	providerId, err := strconv.Atoi(c.QueryParam("provider_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid provider_id")
+	}
+	decks, err := h.ratingStore.GetRateDecks(providerId)
+	if err != nil {
+		return utils.HandleInternalErr("GetRateDecks error occured", err, c)
+	}
+	return c.JSON(http.StatusOK, &decks)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/rating"
+	"lineblocs.com/api/utils"
+)
+
+type fakeRatingStore struct {
+	rating.Store
+	imported []*model.RateDeckEntry
+}
+
+func (s *fakeRatingStore) ImportRateDeck(providerId int, name string, entries []*model.RateDeckEntry) ([]*model.RateDeck, error) {
+	s.imported = entries
+	return utils.BuildRateDeckVersions(providerId, name, entries), nil
+}
+
+func newRateDeckRequest(t *testing.T, deck string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("provider_id", "3")
+	form.WriteField("name", "NANP")
+	file, err := form.CreateFormFile("file", "deck.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(deck))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/rating/importRateDeck", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	return req
+}
+
+func TestImportRateDeck(t *testing.T) {
+	tests := []struct {
+		name         string
+		deck         string
+		want         int
+		wantWarnings int
+	}{
+		{"valid", "prefix,country,rate,effective\n1,US,0.01,2026-01-01\n", http.StatusOK, 0},
+		{"nested prefix of another country", "1,US,0.01,2026-01-01\n1876,JM,0.12,2026-01-01\n", http.StatusOK, 1},
+		{"conflicting rates", "44,GB,0.03,2026-01-01\n44,GB,0.04,2026-01-01\n", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeRatingStore{}
+			h := &Handler{ratingStore: store}
+			rec := httptest.NewRecorder()
+			if err := h.ImportRateDeck(echo.New().NewContext(newRateDeckRequest(t, tt.deck), rec)); err != nil {
+				t.Fatalf("ImportRateDeck: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				if store.imported != nil {
+					t.Error("deck with problems was imported")
+				}
+				return
+			}
+			var result model.RateDeckImport
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Decks) != 1 || len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("got %d decks and warnings %q, want 1 deck and %d warnings", len(result.Decks), result.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/idempotency"
 	"lineblocs.com/api/model"
+	"lineblocs.com/api/recording"
+	"lineblocs.com/api/storage"
 	"lineblocs.com/api/utils"
 )
 
@@ -28,6 +34,23 @@ func (h *Handler) CreateRecording(c echo.Context) error {
 		return utils.HandleInternalErr("CreateRecording Could not decode JSON", err, c)
 	}
 
+	recording.IdempotencyKey = utils.GetIdempotencyKey(c, recording.IdempotencyKey)
+	existingId, found, err := h.lookupIdempotentRequest(c, idempotency.Recordings, recording.WorkspaceId, recording.IdempotencyKey)
+	if err != nil {
+		return utils.HandleInternalErr("CreateRecording could not lookup idempotency key..", err, c)
+	}
+	if found {
+		existing, err := h.recordingStore.GetRecordingFromDB(int(existingId))
+		if err != nil {
+			return utils.HandleInternalErr("CreateRecording could not get recording..", err, c)
+		}
+		if conflict, err := replayConflict(c, recording.WorkspaceId, existing.WorkspaceId); conflict {
+			return err
+		}
+		c.Response().Writer.Header().Set("X-Recording-ID", strconv.FormatInt(existingId, 10))
+		return c.JSON(http.StatusOK, &existing)
+	}
+
 	recording.APIId = utils.CreateAPIID("rec")
 
 	workspace, err := h.callStore.GetWorkspaceFromDB(recording.WorkspaceId)
@@ -36,6 +59,9 @@ func (h *Handler) CreateRecording(c echo.Context) error {
 	}
 
 	recId, err := h.recordingStore.CreateRecording(workspace, &recording)
+	if err == utils.ErrIdempotencyConflict {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
 	if err != nil {
 		return utils.HandleInternalErr("CreateRecording error.", err, c)
 	}
@@ -44,58 +70,81 @@ func (h *Handler) CreateRecording(c echo.Context) error {
 }
 
 /*
-Input: file, status, recording_id
-Todo : Update recordings with matching id and upload file to AWS s3
-Output: If success return NoContent in header else return err
+Input: file, recording_id
+Todo : Check the recording storage limit of the workspace, upload the file to its storage and mark the recording completed
+with the uri, size and checksum once stored. Failed uploads are retried and the failure is kept on the recording
+Output: If success return NoContent in header, if the storage limit is reached return StatusForbidden,
+if the recording is already completed or being uploaded return StatusConflict else return err
 */
 func (h *Handler) UpdateRecording(c echo.Context) error {
 	utils.Log(logrus.InfoLevel, "UpdateRecording is called...")
 
 	file, err := c.FormFile("file")
-	status := c.FormValue("status")
-	recordingId := c.FormValue("recording_id")
-	recordingIdInt, err := strconv.Atoi(recordingId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "file is required")
+	}
+	recordingIdInt, err := strconv.Atoi(c.FormValue("recording_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid recording_id")
+	}
 	record, err := h.recordingStore.GetRecordingFromDB(recordingIdInt)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, "recording not found")
+	}
 	if err != nil {
 		return utils.HandleInternalErr("Could not get recording..", err, c)
 	}
+	if record.Status == recording.StatusCompleted {
+		return c.JSON(http.StatusConflict, "recording is already completed")
+	}
 
 	workspace, err := h.callStore.GetWorkspaceFromDB(record.WorkspaceId)
 	if err != nil {
-		// return utils.HandleInternalErr("Could not get workspace..", err, c)
-		return c.String(http.StatusOK, "Could not get workspace..")
+		return utils.HandleInternalErr("Could not get workspace..", err, c)
 	}
 
-	src, err := file.Open()
+	plan, err := h.planStore.GetPlan(workspace)
 	if err != nil {
-		return utils.HandleInternalErr("UpdateRecording error occured", err, c)
+		return utils.HandleInternalErr("Could not get plan..", err, c)
+	}
+	backend, err := h.getStorage(workspace)
+	if err != nil {
+		return utils.HandleInternalErr("Could not get storage..", err, c)
 	}
-	defer src.Close()
 
-	dst, err := os.OpenFile(file.Filename, os.O_WRONLY|os.O_CREATE, 0666)
+	// Will not save if space is over the limit, the size is reserved before the upload starts
+	var limit *int
+	if plan.RecordingStorageMB != nil {
+		bytes := *plan.RecordingStorageMB * 1024 * 1024
+		limit = &bytes
+	}
+	err = h.recordingStore.StartRecordingUpload(record.Id, workspace.Id, file.Size, limit)
+	if errors.Is(err, utils.ErrRecordingStorageFull) {
+		utils.Log(logrus.InfoLevel, fmt.Sprintf("Not saving recording %d due to space limit reached..", record.Id))
+		return c.JSON(http.StatusForbidden, err.Error())
+	}
+	if errors.Is(err, utils.ErrUploadInProgress) {
+		return c.JSON(http.StatusConflict, err.Error())
+	}
 	if err != nil {
 		return utils.HandleInternalErr("UpdateRecording error occured", err, c)
 	}
-	defer dst.Close()
-	size, err := h.recordingStore.GetRecordingSpace(workspace.Id)
+
+	key := storage.Key(storage.RecordingsFolder, record.APIId)
+	open := func() (io.ReadCloser, error) {
+		return file.Open()
+	}
+	result, err := storage.UploadVerified(c.Request().Context(), backend, key, file.Header.Get(echo.HeaderContentType), file.Size, open, storage.UploadAttempts())
 	if err != nil {
-		return utils.HandleInternalErr("Could not get recording space..", err, c)
+		if failErr := h.recordingStore.FailRecordingUpload(record.Id, result.Attempts, err); failErr != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not record failed upload of recording %d: %s", record.Id, failErr.Error()))
+		}
+		return utils.HandleInternalErr("UpdateRecording could not upload file..", err, c)
 	}
-	apiId := utils.CreateAPIID("rec")
-	err = h.recordingStore.UpdateRecording(apiId, status, file.Size, recordingIdInt)
+	err = h.recordingStore.CompleteRecordingUpload(record.Id, result.URI, result.Size, result.Checksum, result.Attempts, backend.Location())
 	if err != nil {
 		return utils.HandleInternalErr("UpdateRecording error occured", err, c)
 	}
-
-	// Will not save if space is over the limit
-	limit, err := utils.GetPlanRecordingLimit(workspace)
-	newSpace := size + int(file.Size)
-	if newSpace > limit {
-		return utils.HandleInternalErr("Not saving recording due to space limit reached..", err, c)
-	}
-
-	// Upload recording file to AWS s3
-	go utils.UploadS3("recordings", apiId, src)
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"lineblocs.com/api/call"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/plan"
+	"lineblocs.com/api/recording"
+	"lineblocs.com/api/storage"
+	"lineblocs.com/api/user"
+	"lineblocs.com/api/utils"
+)
+
+type fakeRecordingStore struct {
+	recording.Store
+	startErr  error
+	completed bool
+	checksum  string
+}
+
+func (s *fakeRecordingStore) GetRecordingFromDB(id int) (*model.Recording, error) {
+	return &model.Recording{Id: id, WorkspaceId: 1, APIId: "rec-1", Status: recording.StatusStarted}, nil
+}
+
+func (s *fakeRecordingStore) StartRecordingUpload(recordingId int, workspaceId int, size int64, limit *int) error {
+	return s.startErr
+}
+
+func (s *fakeRecordingStore) CompleteRecordingUpload(recordingId int, uri string, size int64, checksum string, attempts int, location model.StorageLocation) error {
+	s.completed = true
+	s.checksum = checksum
+	return nil
+}
+
+type fakeRecordingCallStore struct {
+	call.Store
+}
+
+func (s *fakeRecordingCallStore) GetWorkspaceFromDB(id int) (*model.Workspace, error) {
+	return &model.Workspace{Id: id}, nil
+}
+
+type fakeRecordingPlanStore struct {
+	plan.Store
+}
+
+func (s *fakeRecordingPlanStore) GetPlan(workspace *model.Workspace) (*model.Plan, error) {
+	return &model.Plan{}, nil
+}
+
+type fakeRecordingUserStore struct {
+	user.Store
+}
+
+func (s *fakeRecordingUserStore) GetWorkspaceParams(workspaceId int) (*[]model.WorkspaceParam, error) {
+	return &[]model.WorkspaceParam{}, nil
+}
+
+func newUpdateRecordingRequest(t *testing.T, data []byte) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("recording_id", "7")
+	file, err := form.CreateFormFile("file", "rec.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/recording/updateRecording", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	return req
+}
+
+func TestUpdateRecording(t *testing.T) {
+	data := []byte("recording bytes")
+	sum := sha256.Sum256(data)
+
+	tests := []struct {
+		name     string
+		startErr error
+		want     int
+		wantFile bool
+	}{
+		{"uploaded", nil, http.StatusNoContent, true},
+		{"upload already in progress", utils.ErrUploadInProgress, http.StatusConflict, false},
+		{"storage full", utils.ErrRecordingStorageFull, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := &fakeRecordingStore{startErr: tt.startErr}
+			h := &Handler{
+				recordingStore: store,
+				callStore:      &fakeRecordingCallStore{},
+				planStore:      &fakeRecordingPlanStore{},
+				userStore:      &fakeRecordingUserStore{},
+				storage:        storage.NewProvider(storage.Config{Type: storage.TypeLocal, LocalDir: dir}),
+			}
+			rec := httptest.NewRecorder()
+			if err := h.UpdateRecording(echo.New().NewContext(newUpdateRecordingRequest(t, data), rec)); err != nil {
+				t.Fatalf("UpdateRecording: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			stored, err := ioutil.ReadFile(filepath.Join(dir, storage.Key(storage.RecordingsFolder, "rec-1")))
+			if tt.wantFile != (err == nil) {
+				t.Fatalf("file stored = %v, want %v", err == nil, tt.wantFile)
+			}
+			if !tt.wantFile {
+				if store.completed {
+					t.Error("refused upload was completed")
+				}
+				return
+			}
+			if !bytes.Equal(stored, data) || store.checksum != hex.EncodeToString(sum[:]) {
+				t.Errorf("stored %q with checksum %s", stored, store.checksum)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/storage"
 	"lineblocs.com/api/utils"
 )
 
@@ -32,17 +33,62 @@ func (h *Handler) Register(e *echo.Echo) {
 	// For Health Check
 	e.GET("/healthz", h.Healthz)
 
+	// Signed downloads of the local storage backend, the signature authorizes the request
+	e.GET(storage.DownloadPath, h.DownloadObject)
+
 	// Call Related Routing
 	g.POST("/call/createCall", h.CreateCall)
 	g.POST("/call/updateCall", h.UpdateCall)
 	g.GET("/call/fetchCall", h.FetchCall)
+	g.GET("/call/getCallEvents", h.GetCallEvents)
+	g.GET("/call/listCalls", h.ListCalls)
+	g.GET("/call/exportCalls", h.ExportCalls)
+	g.GET("/call/getActiveCallCount", h.GetActiveCallCount)
+	g.GET("/call/getCallLegs", h.GetCallLegs)
+	g.GET("/call/listLiveCalls", h.ListLiveCalls)
+	g.POST("/call/requestHangup", h.RequestHangup)
+	g.GET("/call/getPendingCommands", h.GetPendingCallCommands)
+	g.POST("/call/acknowledgeCommand", h.AcknowledgeCallCommand)
+	g.POST("/call/createQualityReport", h.CreateQualityReport)
+	g.GET("/call/getQualityReports", h.GetQualityReports)
+	g.GET("/call/getQualityStats", h.GetQualityStats)
+	g.GET("/call/getCalledCountries", h.GetCalledCountries)
+	g.POST("/call/approveCalledCountry", h.ApproveCalledCountry)
 	g.POST("/call/setSIPCallID", h.SetSIPCallID)
 	g.POST("/call/setProviderByIP", h.SetProviderByIP)
+
+	// Conference Related Routing
 	g.POST("/conference/createConference", h.CreateConference)
+	g.POST("/conference/updateConferenceSettings", h.UpdateConferenceSettings)
+	g.POST("/conference/validateParticipant", h.ValidateConferenceParticipant)
+	g.POST("/conference/joinConference", h.JoinConference)
+	g.POST("/conference/leaveConference", h.LeaveConference)
+	g.POST("/conference/updateParticipantRole", h.UpdateParticipantRole)
+	g.GET("/conference/getLiveParticipants", h.GetLiveParticipants)
+	g.GET("/conference/getSessions", h.GetConferenceSessions)
+	g.GET("/conference/getSessionParticipants", h.GetSessionParticipants)
+
+	// Fraud Related Routing
+	g.GET("/fraud/getDecisions", h.GetFraudDecisions)
+	g.GET("/fraud/getSuspension", h.GetWorkspaceSuspension)
+	g.POST("/fraud/liftSuspension", h.LiftWorkspaceSuspension)
 
 	// Debit Related Routing
 	g.POST("/debit/createDebit", h.CreateDebit)
 	g.POST("/debit/createAPIUsageDebit", h.CreateAPIUsageDebit)
+	g.GET("/debit/authorizeCall", h.AuthorizeCall)
+	g.GET("/debit/getUsageSummary", h.GetUsageSummary)
+
+	// Metering Related Routing
+	g.GET("/metering/getUsageTypes", h.GetUsageTypes)
+
+	// Rating Related Routing
+	g.POST("/rating/importRateDeck", h.ImportRateDeck)
+	g.GET("/rating/getRateDecks", h.GetRateDecks)
+
+	// Plan Related Routing
+	g.GET("/plan/getPlan", h.GetPlan)
+	g.GET("/plan/getPlans", h.GetPlans)
 
 	// Debugger Log Related Routing
 	g.POST("/debugger/createLog", h.CreateLog)
@@ -50,15 +96,18 @@ func (h *Handler) Register(e *echo.Echo) {
 
 	// Fax Related Routing
 	g.POST("/fax/createFax", h.CreateFax)
+	g.GET("/fax/getDownloadURL", h.GetFaxDownloadURL)
 
 	// Recording Related Routing
 	g.POST("/recording/createRecording", h.CreateRecording)
 	g.POST("/recording/updateRecording", h.UpdateRecording)
 	g.POST("/recording/updateRecordingTranscription", h.UpdateRecordingTranscription)
 	g.GET("/recording/getRecording", h.GetRecording)
+	g.GET("/recording/getDownloadURL", h.GetRecordingDownloadURL)
 
 	// Carrier Related Routing
 	g.POST("/carrier/createSIPReport", h.CreateSIPReport)
+	g.GET("/carrier/getCarrierStats", h.GetCarrierStats)
 	g.GET("/carrier/processRouterFlow", h.ProcessRouterFlow)
 
 	// User Related Routing
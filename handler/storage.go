@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/recording"
+	"lineblocs.com/api/storage"
+	"lineblocs.com/api/utils"
+)
+
+// Workspace param selecting the storage region, the deployment default is used when unset.
+// It is the only source of the region, workspaces rows have no region column
+const storageRegionParam = "storage_region"
+
+/*
+Input: Workspace model
+Todo : Get the storage backend of the region set in the storage_region param of the workspace
+Output: First Value: storage Backend, Second Value: error
+*/
+func (h *Handler) getStorage(workspace *model.Workspace) (storage.Backend, error) {
+	params, err := h.userStore.GetWorkspaceParams(workspace.Id)
+	if err != nil {
+		return nil, err
+	}
+	region, _ := utils.GetWorkspaceParam(params, storageRegionParam)
+	return h.storage.ForRegion(region)
+}
+
+/*
+Input: workspace_id, expires_in
+Todo : Read the owning workspace and the lifetime of a signed URL from the query
+Output: First Value: workspace id, Second Value: expiry, Third Value: error message, empty when valid
+*/
+func getDownloadParams(c echo.Context) (int, time.Duration, string) {
+	workspaceId, err := strconv.Atoi(c.QueryParam("workspace_id"))
+	if err != nil {
+		return 0, 0, "invalid workspace_id"
+	}
+	expires := storage.URLExpiry()
+	if value := c.QueryParam("expires_in"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, 0, "invalid expires_in"
+		}
+		expires = storage.ClampURLExpiry(time.Duration(seconds) * time.Second)
+	}
+	return workspaceId, expires, ""
+}
+
+/*
+Input: echo context, workspace id, StorageLocation model of the object, object key, expiry
+Todo : Sign a download URL with the backend the object was stored with. Objects stored before their location
+was kept fall back to the current storage of the workspace
+Output: If success return DownloadURL model else return err
+*/
+func (h *Handler) issueDownloadURL(c echo.Context, workspaceId int, location *model.StorageLocation, key string, expires time.Duration) error {
+	var backend storage.Backend
+	var err error
+	if location != nil {
+		backend, err = h.storage.ForLocation(*location)
+	} else {
+		var workspace *model.Workspace
+		workspace, err = h.callStore.GetWorkspaceFromDB(workspaceId)
+		if err != nil {
+			return utils.HandleInternalErr("Could not get workspace..", err, c)
+		}
+		backend, err = h.getStorage(workspace)
+	}
+	if err != nil {
+		return utils.HandleInternalErr("Could not get storage..", err, c)
+	}
+	expiresAt := time.Now().Add(expires)
+	url, err := backend.SignedURL(key, expires)
+	if err != nil {
+		return utils.HandleInternalErr("Could not sign download url..", err, c)
+	}
+	return c.JSON(http.StatusOK, &model.DownloadURL{URL: url, ExpiresAt: expiresAt})
+}
+
+/*
+Input: api_id, workspace_id, expires_in
+Todo : Issue a short lived signed download URL for a completed recording owned by the workspace
+Output: If success return DownloadURL model, if the workspace has no such recording return StatusNotFound,
+if the recording is not uploaded yet return StatusConflict else return err
+*/
+func (h *Handler) GetRecordingDownloadURL(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetRecordingDownloadURL is called...")
+
+	workspaceId, expires, msg := getDownloadParams(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, msg)
+	}
+	record, err := h.recordingStore.GetRecordingByAPIId(c.QueryParam("api_id"))
+	// Recordings of other workspaces are reported as missing so their ids cannot be probed
+	if err == sql.ErrNoRows || (err == nil && record.WorkspaceId != workspaceId) {
+		return c.JSON(http.StatusNotFound, "recording not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("GetRecordingDownloadURL could not get recording..", err, c)
+	}
+	if record.Status != recording.StatusCompleted {
+		return c.JSON(http.StatusConflict, "recording is not uploaded yet")
+	}
+	return h.issueDownloadURL(c, workspaceId, record.Location, storage.Key(storage.RecordingsFolder, record.APIId), expires)
+}
+
+/*
+Input: api_id, workspace_id, expires_in
+Todo : Issue a short lived signed download URL for a fax owned by the workspace
+Output: If success return DownloadURL model, if the workspace has no such fax return StatusNotFound else return err
+*/
+func (h *Handler) GetFaxDownloadURL(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "GetFaxDownloadURL is called...")
+
+	workspaceId, expires, msg := getDownloadParams(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, msg)
+	}
+	fax, err := h.faxStore.GetFaxByAPIId(c.QueryParam("api_id"))
+	if err == sql.ErrNoRows || (err == nil && fax.WorkspaceId != workspaceId) {
+		return c.JSON(http.StatusNotFound, "fax not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("GetFaxDownloadURL could not get fax..", err, c)
+	}
+	return h.issueDownloadURL(c, workspaceId, fax.Location, storage.Key(storage.FaxesFolder, fax.APIId), expires)
+}
+
+/*
+Input: key, expires, signature
+Todo : Serve an object of the local storage backend to the holder of a signed URL
+Output: If success return the file, if the signature is invalid return StatusForbidden,
+if the url expired return StatusGone else return err
+*/
+func (h *Handler) DownloadObject(c echo.Context) error {
+	utils.Log(logrus.InfoLevel, "DownloadObject is called...")
+
+	// Objects stored locally stay downloadable after the deployment moves to another backend
+	backend, err := h.storage.ForLocation(model.StorageLocation{Backend: storage.TypeLocal})
+	if err != nil {
+		return utils.HandleInternalErr("DownloadObject could not get storage..", err, c)
+	}
+	opener, ok := backend.(storage.SignedOpener)
+	if !ok {
+		return c.JSON(http.StatusNotFound, "downloads are served by the storage backend")
+	}
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, "invalid expires")
+	}
+
+	key := c.QueryParam("key")
+	file, err := opener.OpenSigned(key, expires, c.QueryParam("signature"))
+	if errors.Is(err, utils.ErrInvalidSignature) {
+		return c.JSON(http.StatusForbidden, err.Error())
+	}
+	if errors.Is(err, utils.ErrSignedURLExpired) {
+		return c.JSON(http.StatusGone, err.Error())
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, "object not found")
+	}
+	if err != nil {
+		return utils.HandleInternalErr("DownloadObject could not open object..", err, c)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return utils.HandleInternalErr("DownloadObject could not open object..", err, c)
+	}
+	http.ServeContent(c.Response(), c.Request(), path.Base(key), info.ModTime(), file)
+	return nil
+}
@@ -249,6 +249,13 @@ func (h *Handler) GetPSTNProviderIP(c echo.Context) error {
 	if err != nil {
 		return utils.HandleInternalErr("GetPSTNProviderIP error", err, c)
 	}
+	suspension, err := h.fraudStore.GetSuspension(workspace.Id)
+	if err != nil {
+		return utils.HandleInternalErr("GetPSTNProviderIP error", err, c)
+	}
+	if suspension != nil {
+		return workspaceSuspended(c, suspension)
+	}
 
 	// If BYOEnabled GetBYOPSTNProvider else BestPSTNProvider
 	if workspace.BYOEnabled {
@@ -530,6 +537,17 @@ func (h *Handler) IncomingDIDValidation(c echo.Context) error {
 			return utils.HandleInternalErr("IncomingDIDValidation no match found 1", err, c)
 		}
 		utils.Log(logrus.InfoLevel, "Matched incoming DID..")
+		workspaceId, err := strconv.Atoi(info.DidWorkspaceId)
+		if err != nil {
+			return utils.HandleInternalErr("IncomingDIDValidation invalid workspace id", err, c)
+		}
+		hasCapacity, err := h.hasCallCapacity(workspaceId)
+		if err != nil {
+			return utils.HandleInternalErr("IncomingDIDValidation capacity check", err, c)
+		}
+		if !hasCapacity {
+			return capacityExceeded(c, workspaceId)
+		}
 		valid, err := h.userStore.FinishValidation(number, info.DidWorkspaceId)
 		if err != nil {
 			return utils.HandleInternalErr("IncomingDIDValidation error 2 valid", err, c)
@@ -551,6 +569,17 @@ func (h *Handler) IncomingDIDValidation(c echo.Context) error {
 			return utils.HandleInternalErr("IncomingDIDValidation no match found 2", err, c)
 		}
 		utils.Log(logrus.InfoLevel, "Matched incoming DID..")
+		workspaceId, err := strconv.Atoi(byoInfo.DidWorkspaceId)
+		if err != nil {
+			return utils.HandleInternalErr("IncomingDIDValidation invalid workspace id", err, c)
+		}
+		hasCapacity, err := h.hasCallCapacity(workspaceId)
+		if err != nil {
+			return utils.HandleInternalErr("IncomingDIDValidation capacity check", err, c)
+		}
+		if !hasCapacity {
+			return capacityExceeded(c, workspaceId)
+		}
 		valid, err := h.userStore.FinishValidation(number, byoInfo.DidWorkspaceId)
 		if err != nil {
 			return utils.HandleInternalErr("IncomingDIDValidation error 4 valid", err, c)
@@ -3,6 +3,7 @@ package helpers
 
 
 import (
+	"fmt"
 	"github.com/ttacon/libphonenumber"
 	"strconv"
 )
@@ -18,4 +19,18 @@ func ParseCountryCode( number string ) (string, error) {
 	code := num.GetCountryCode()
 
 	return strconv.Itoa( int( code ) ), nil
-}
\ No newline at end of file
+}
+// Like ParseCountryCode, but numbers that are not valid in their country (extensions, short codes) are an error
+func ParseValidCountryCode( number string ) (string, error) {
+	num, err := libphonenumber.Parse(number, "")
+
+	if err != nil {
+		return "", err
+	}
+
+	if !libphonenumber.IsValidNumber( num ) {
+		return "", fmt.Errorf("%s is not a valid phone number", number)
+	}
+
+	return strconv.Itoa( int( num.GetCountryCode() ) ), nil
+}
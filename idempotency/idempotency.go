@@ -0,0 +1,17 @@
+package idempotency
+
+/*
+Interface of Idempotency Store.
+Implementation of Idempotency Store is located /store/idempotency
+*/
+type Store interface {
+	LookupIdempotencyKey(string, int, string) (int64, error)
+}
+
+// Tables that persist the idempotency key of the request that created a row, keys are unique per workspace
+const (
+	Debits     = "users_debits"
+	Calls      = "calls"
+	Recordings = "recordings"
+	Faxes      = "faxes"
+)
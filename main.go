@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -14,9 +15,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/mrwaggel/golimiter"
 	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/call"
 	"lineblocs.com/api/handler"
 	"lineblocs.com/api/model"
 	"lineblocs.com/api/router"
+	"lineblocs.com/api/storage"
 	"lineblocs.com/api/store"
 	"lineblocs.com/api/utils"
 )
@@ -89,12 +92,25 @@ func startServer() {
 	as := store.NewAdminStore(db)
 	cs := store.NewCallStore(db)
 	crs := store.NewCarrierStore(db)
+	cfs := store.NewConferenceStore(db)
 	ds := store.NewDebitStore(db)
 	fs := store.NewFaxStore(db)
+	frs := store.NewFraudStore(db)
+	is := store.NewIdempotencyStore(db)
 	ls := store.NewLoggerStore(db)
+	ms := store.NewMeteringStore(db)
+	ps := store.NewPlanStore(db)
+	qs := store.NewQualityStore(db)
+	rts := store.NewRatingStore(db)
 	rs := store.NewRecordingStore(db)
 	us := store.NewUserStore(db)
-	h := handler.NewHandler(as, cs, crs, ds, fs, ls, rs, us)
+	ct := call.NewTracker(getCallTrackerTTL())
+	sp := storage.NewProvider(storage.ConfigFromEnv())
+	if _, err := sp.ForRegion(""); err != nil {
+		utils.Log(logrus.PanicLevel, err.Error())
+		panic(err)
+	}
+	h := handler.NewHandler(as, cs, crs, cfs, ds, fs, frs, is, ls, ms, ps, qs, rts, rs, us, ct, sp)
 
 	// Register Handler for Echo context
 	h.Register(r)
@@ -118,6 +134,16 @@ func startServer() {
 	utils.Log(logrus.InfoLevel, "Started server...")
 }
 
+// Calls not updated within CALL_TRACKER_TTL seconds stop counting towards concurrent call limits
+func getCallTrackerTTL() time.Duration {
+	ttl, err := strconv.Atoi(utils.ReadEnv("CALL_TRACKER_TTL", strconv.Itoa(utils.MaxCallDuration)))
+	if err != nil || ttl <= 0 {
+		utils.Log(logrus.WarnLevel, "Invalid CALL_TRACKER_TTL, using the max call duration")
+		ttl = utils.MaxCallDuration
+	}
+	return time.Duration(ttl) * time.Second
+}
+
 // Configure Limit Handler for Echo context
 func limitHandler(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -0,0 +1,120 @@
+package metering
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Interface of Metering Store.
+Implementation of Metering Store is located /store/metering
+*/
+type Store interface {
+	RecordUsage(*model.Workspace, *model.Plan, *model.UsageEvent) (*model.UsageEvent, error)
+	GetUsageTypes(*model.Workspace) ([]*model.UsageType, error)
+}
+
+// Billable API usage types
+const (
+	TTS              = "TTS"
+	STT              = "STT"
+	AMD              = "AMD"
+	FaxPages         = "FAX_PAGES"
+	RecordingStorage = "RECORDING_STORAGE"
+	NumberRental     = "NUMBER_RENTAL"
+)
+
+// Registry of usage types with their default unit prices in dollars,
+// prices can be overridden per plan in the usage_prices table
+var registry = map[string]model.UsageType{
+	TTS:              {Name: TTS, Unit: "character", UnitPrice: 0.000005},
+	STT:              {Name: STT, Unit: "second", UnitPrice: 0.0004},
+	AMD:              {Name: AMD, Unit: "detection", UnitPrice: 0.0025},
+	FaxPages:         {Name: FaxPages, Unit: "page", UnitPrice: 0.01},
+	RecordingStorage: {Name: RecordingStorage, Unit: "GB-month", UnitPrice: 0.025},
+	NumberRental:     {Name: NumberRental, Unit: "number-month", UnitPrice: 1.00},
+}
+
+/*
+Input: usage type name
+Todo : Get the registered usage type, names are case insensitive
+Output: First Value: UsageType model, Second Value: error
+*/
+func LookupUsageType(name string) (model.UsageType, error) {
+	usageType, ok := registry[strings.ToUpper(strings.TrimSpace(name))]
+	if !ok {
+		return model.UsageType{}, fmt.Errorf("%w: %s", utils.ErrUnknownUsageType, name)
+	}
+	return usageType, nil
+}
+
+/*
+Todo : Get every registered usage type ordered by name
+Output: list of UsageType model
+*/
+func UsageTypes() []model.UsageType {
+	types := make([]model.UsageType, 0, len(registry))
+	for _, usageType := range registry {
+		types = append(types, usageType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+/*
+Input: Plan model, usage type name
+Todo : Get the quantity of a usage type included in the plan each month
+Output: included quantity
+*/
+func IncludedQuantity(plan *model.Plan, name string) float64 {
+	if plan == nil {
+		return 0
+	}
+	switch name {
+	case TTS:
+		return float64(plan.TTSCharactersIncluded)
+	case STT:
+		return float64(plan.STTSecondsIncluded)
+	}
+	return 0
+}
+
+/*
+Input: DebitAPI model
+Todo : Get the metered quantity of a usage debit request, TTS and STT keep their original params
+Output: quantity
+*/
+func Quantity(debitApi *model.DebitAPI) float64 {
+	switch strings.ToUpper(debitApi.Type) {
+	case TTS:
+		if debitApi.Params.Quantity == 0 {
+			return float64(debitApi.Params.Length)
+		}
+	case STT:
+		if debitApi.Params.Quantity == 0 {
+			return debitApi.Params.RecordingLength
+		}
+	}
+	return debitApi.Params.Quantity
+}
+
+/*
+Input: usage type of a debit, empty for call debits
+Todo : Get the invoice category a debit is summarized under
+Output: category
+*/
+func Category(usageType string) string {
+	switch usageType {
+	case "":
+		return "call"
+	case RecordingStorage:
+		return "recording"
+	case FaxPages:
+		return "fax"
+	}
+	return "api_usage"
+}
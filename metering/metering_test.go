@@ -0,0 +1,89 @@
+package metering
+
+import (
+	"errors"
+	"testing"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+func TestLookupUsageType(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"TTS", TTS, false},
+		{" fax_pages ", FaxPages, false},
+		{"stt", STT, false},
+		{"SMS", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		usageType, err := LookupUsageType(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("LookupUsageType(%q) err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, utils.ErrUnknownUsageType) {
+			t.Errorf("LookupUsageType(%q) err = %v, want ErrUnknownUsageType", tt.name, err)
+		}
+		if usageType.Name != tt.want {
+			t.Errorf("LookupUsageType(%q) = %s, want %s", tt.name, usageType.Name, tt.want)
+		}
+	}
+}
+
+func TestIncludedQuantity(t *testing.T) {
+	plan := &model.Plan{TTSCharactersIncluded: 1000, STTSecondsIncluded: 60}
+	tests := []struct {
+		plan  *model.Plan
+		usage string
+		want  float64
+	}{
+		{plan, TTS, 1000},
+		{plan, STT, 60},
+		{plan, AMD, 0},
+		{nil, TTS, 0},
+	}
+	for _, tt := range tests {
+		if got := IncludedQuantity(tt.plan, tt.usage); got != tt.want {
+			t.Errorf("IncludedQuantity(%s) = %g, want %g", tt.usage, got, tt.want)
+		}
+	}
+}
+
+func TestQuantity(t *testing.T) {
+	tests := []struct {
+		name  string
+		debit model.DebitAPI
+		want  float64
+	}{
+		{"tts length", model.DebitAPI{Type: "tts", Params: model.DebitAPIParams{Length: 120}}, 120},
+		{"tts quantity wins", model.DebitAPI{Type: TTS, Params: model.DebitAPIParams{Length: 120, Quantity: 80}}, 80},
+		{"stt recording length", model.DebitAPI{Type: STT, Params: model.DebitAPIParams{RecordingLength: 12.5}}, 12.5},
+		{"other quantity", model.DebitAPI{Type: FaxPages, Params: model.DebitAPIParams{Length: 3, Quantity: 2}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Quantity(&tt.debit); got != tt.want {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := map[string]string{
+		"":               "call",
+		RecordingStorage: "recording",
+		FaxPages:         "fax",
+		TTS:              "api_usage",
+		NumberRental:     "api_usage",
+	}
+	for usageType, want := range tests {
+		if got := Category(usageType); got != want {
+			t.Errorf("Category(%q) = %s, want %s", usageType, got, want)
+		}
+	}
+}
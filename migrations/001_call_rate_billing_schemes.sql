@@ -0,0 +1,18 @@
+-- Billing scheme of provider rates, NULL keeps the 60/60 default
+ALTER TABLE `call_rates`
+  ADD COLUMN `billing_increment` INT UNSIGNED NULL,
+  ADD COLUMN `minimum_duration` INT UNSIGNED NULL;
+
+-- Flat per minute rates of SIP and WebRTC calls per plan
+CREATE TABLE `plan_call_rates` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `plan` VARCHAR(255) NOT NULL,
+  `call_type` VARCHAR(16) NOT NULL,
+  `rate` DECIMAL(12,6) NOT NULL,
+  `billing_increment` INT UNSIGNED NULL,
+  `minimum_duration` INT UNSIGNED NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `plan_call_rates_plan_call_type_index` (`plan`, `call_type`)
+);
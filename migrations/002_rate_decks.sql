@@ -0,0 +1,24 @@
+-- Versions of a provider's rate deck, the latest version effective now is used for rating
+CREATE TABLE `rate_decks` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `provider_id` INT UNSIGNED NOT NULL,
+  `name` VARCHAR(255) NOT NULL,
+  `effective_from` DATETIME NOT NULL,
+  `entry_count` INT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `rate_decks_provider_id_effective_from_unique` (`provider_id`, `effective_from`)
+);
+
+CREATE TABLE `rate_deck_entries` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `rate_deck_id` INT UNSIGNED NOT NULL,
+  `dial_prefix` VARCHAR(32) NOT NULL,
+  `country` VARCHAR(255) NOT NULL DEFAULT '',
+  `rate` DECIMAL(12,6) NOT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `rate_deck_entries_rate_deck_id_dial_prefix_index` (`rate_deck_id`, `dial_prefix`)
+);
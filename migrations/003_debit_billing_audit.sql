@@ -0,0 +1,17 @@
+-- Minimum charge of a rate in dollars, NULL has none
+ALTER TABLE `call_rates`
+  ADD COLUMN `minimum_charge` DECIMAL(12,6) NULL;
+
+-- A PSTN row without a rate only sets the billing scheme of the plan
+ALTER TABLE `plan_call_rates`
+  MODIFY COLUMN `rate` DECIMAL(12,6) NULL,
+  ADD COLUMN `minimum_charge` DECIMAL(12,6) NULL;
+
+-- Debits keep fractions of a cent and how they were billed
+ALTER TABLE `users_debits`
+  MODIFY COLUMN `cents` DECIMAL(16,4) NOT NULL,
+  ADD COLUMN `seconds` DECIMAL(12,3) NULL,
+  ADD COLUMN `billable_seconds` INT UNSIGNED NULL,
+  ADD COLUMN `billing_increment` INT UNSIGNED NULL,
+  ADD COLUMN `minimum_duration` INT UNSIGNED NULL,
+  ADD COLUMN `rate` DECIMAL(12,6) NULL;
@@ -0,0 +1,14 @@
+-- Prepaid top ups, the balance of a workspace is its credits minus its debits
+CREATE TABLE `users_credits` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `cents` DECIMAL(16,4) NOT NULL,
+  `source` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `users_credits_user_id_index` (`user_id`)
+);
+
+ALTER TABLE `users_debits`
+  ADD KEY `users_debits_user_id_created_at_index` (`user_id`, `created_at`);
@@ -0,0 +1,16 @@
+-- Idempotency keys sent by clients, NULL when a request has none
+ALTER TABLE `users_debits`
+  ADD COLUMN `idempotency_key` VARCHAR(255) NULL,
+  ADD UNIQUE KEY `users_debits_idempotency_key_unique` (`idempotency_key`);
+
+ALTER TABLE `calls`
+  ADD COLUMN `idempotency_key` VARCHAR(255) NULL,
+  ADD UNIQUE KEY `calls_idempotency_key_unique` (`idempotency_key`);
+
+ALTER TABLE `recordings`
+  ADD COLUMN `idempotency_key` VARCHAR(255) NULL,
+  ADD UNIQUE KEY `recordings_idempotency_key_unique` (`idempotency_key`);
+
+ALTER TABLE `faxes`
+  ADD COLUMN `idempotency_key` VARCHAR(255) NULL,
+  ADD UNIQUE KEY `faxes_idempotency_key_unique` (`idempotency_key`);
@@ -0,0 +1,23 @@
+-- Plan definitions, NULL limits are unlimited. Recording storage is in MB.
+CREATE TABLE `plans` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(255) NOT NULL,
+  `recording_storage_mb` INT UNSIGNED NULL,
+  `fax_limit` INT UNSIGNED NULL,
+  `concurrent_call_limit` INT UNSIGNED NULL,
+  `extension_limit` INT UNSIGNED NULL,
+  `tts_characters_included` INT UNSIGNED NOT NULL DEFAULT 0,
+  `stt_seconds_included` INT UNSIGNED NOT NULL DEFAULT 0,
+  `trial_days` INT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `plans_name_unique` (`name`)
+);
+
+-- The limits that used to be hard coded. Trials last 10 days and get the pay-as-you-go limits.
+INSERT INTO `plans` (`name`, `recording_storage_mb`, `fax_limit`, `concurrent_call_limit`, `extension_limit`, `trial_days`, `created_at`, `updated_at`) VALUES
+  ('trial', 1024, 100, NULL, NULL, 10, NOW(), NOW()),
+  ('pay-as-you-go', 1024, 100, NULL, NULL, 0, NOW(), NOW()),
+  ('starter', 2048, 100, NULL, NULL, 0, NOW(), NOW()),
+  ('pro', 32768, NULL, NULL, NULL, 0, NOW(), NOW());
@@ -0,0 +1,31 @@
+-- Ledger of billable API usage, debit_id points to the debit billing the part above the plan allowance
+CREATE TABLE `usage_events` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `usage_type` VARCHAR(32) NOT NULL,
+  `quantity` DECIMAL(16,4) NOT NULL,
+  `billable_quantity` DECIMAL(16,4) NOT NULL,
+  `unit_price` DECIMAL(12,6) NOT NULL,
+  `cents` DECIMAL(16,4) NOT NULL,
+  `debit_id` INT UNSIGNED NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `usage_events_workspace_id_usage_type_created_at_index` (`workspace_id`, `usage_type`, `created_at`)
+);
+
+-- Unit prices in dollars overriding the defaults, a NULL plan applies to every plan
+CREATE TABLE `usage_prices` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `usage_type` VARCHAR(32) NOT NULL,
+  `plan` VARCHAR(255) NULL,
+  `unit_price` DECIMAL(12,6) NOT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `usage_prices_usage_type_plan_unique` (`usage_type`, `plan`)
+);
+
+ALTER TABLE `users_debits`
+  ADD COLUMN `usage_event_id` INT UNSIGNED NULL;
@@ -0,0 +1,6 @@
+-- Direction of call debits and the monthly fee of plans, for usage summaries and invoice previews
+ALTER TABLE `users_debits`
+  ADD COLUMN `direction` VARCHAR(16) NULL;
+
+ALTER TABLE `plans`
+  ADD COLUMN `monthly_fee` DECIMAL(12,2) NOT NULL DEFAULT 0 AFTER `name`;
@@ -0,0 +1,11 @@
+-- Billing alerts sent, at most one per workspace, alert type and period
+CREATE TABLE `billing_alerts` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `alert_type` VARCHAR(32) NOT NULL,
+  `period` VARCHAR(16) NOT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `billing_alerts_workspace_id_alert_type_period_unique` (`workspace_id`, `alert_type`, `period`)
+);
@@ -0,0 +1,6 @@
+-- Call lifecycle timestamps and server-side durations
+ALTER TABLE `calls`
+  ADD COLUMN `ringing_at` DATETIME NULL DEFAULT NULL AFTER `started_at`,
+  ADD COLUMN `answered_at` DATETIME NULL DEFAULT NULL AFTER `ringing_at`,
+  ADD COLUMN `billable_duration` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `duration`,
+  ADD COLUMN `hangup_cause` VARCHAR(64) NULL DEFAULT NULL;
@@ -0,0 +1,16 @@
+-- History of call status events reported by media servers
+CREATE TABLE `call_events` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `call_id` INT UNSIGNED NOT NULL,
+  `status` VARCHAR(32) NOT NULL,
+  `previous_status` VARCHAR(32) NULL DEFAULT NULL,
+  `source_ip` VARCHAR(64) NULL DEFAULT NULL,
+  `hangup_cause` VARCHAR(64) NULL DEFAULT NULL,
+  `sip_status` VARCHAR(16) NULL DEFAULT NULL,
+  `accepted` TINYINT(1) NOT NULL DEFAULT 0,
+  `event_at` DATETIME NOT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `call_events_call_id_index` (`call_id`)
+);
@@ -0,0 +1,4 @@
+-- Indexes backing call listing and keyset pagination
+ALTER TABLE `calls`
+  ADD INDEX `calls_workspace_id_started_at_id_index` (`workspace_id`, `started_at`, `id`),
+  ADD INDEX `calls_workspace_id_duration_id_index` (`workspace_id`, `duration`, `id`);
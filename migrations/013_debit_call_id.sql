@@ -0,0 +1,4 @@
+-- Link call debits to their call so exports can show the rated cost
+ALTER TABLE `users_debits`
+  ADD COLUMN `call_id` INT UNSIGNED NULL DEFAULT NULL AFTER `module_id`,
+  ADD INDEX `users_debits_call_id_index` (`call_id`);
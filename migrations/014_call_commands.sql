@@ -0,0 +1,20 @@
+-- Media server handling each call and the commands queued for it
+ALTER TABLE `calls`
+  ADD COLUMN `media_server_ip` VARCHAR(64) NULL DEFAULT NULL AFTER `provider_id`;
+
+CREATE TABLE `call_commands` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `call_id` INT UNSIGNED NOT NULL,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `media_server_ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `command` VARCHAR(32) NOT NULL,
+  `reason` VARCHAR(255) NOT NULL DEFAULT '',
+  `requested_by` VARCHAR(255) NOT NULL DEFAULT '',
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending',
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  `acknowledged_at` DATETIME NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `call_commands_call_id_status_index` (`call_id`, `status`),
+  KEY `call_commands_media_server_ip_status_index` (`media_server_ip`, `status`)
+);
@@ -0,0 +1,5 @@
+-- Link call legs to the call they were created from
+ALTER TABLE `calls`
+  ADD COLUMN `parent_call_id` INT UNSIGNED NULL DEFAULT NULL,
+  ADD COLUMN `leg_type` VARCHAR(32) NOT NULL DEFAULT 'original',
+  ADD INDEX `calls_parent_call_id_index` (`parent_call_id`);
@@ -0,0 +1,18 @@
+-- RTP quality measured by media servers for each call leg
+CREATE TABLE `call_quality_reports` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `call_id` INT UNSIGNED NOT NULL,
+  `leg` VARCHAR(32) NOT NULL DEFAULT '',
+  `mos` DECIMAL(4,2) NOT NULL,
+  `jitter_ms` DECIMAL(10,2) NOT NULL DEFAULT 0,
+  `packet_loss_pct` DECIMAL(5,2) NOT NULL DEFAULT 0,
+  `rtt_ms` DECIMAL(10,2) NOT NULL DEFAULT 0,
+  `codec` VARCHAR(32) NOT NULL DEFAULT '',
+  `provider_id` INT UNSIGNED NULL DEFAULT NULL,
+  `media_server_ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `call_quality_reports_call_id_index` (`call_id`),
+  KEY `call_quality_reports_created_at_index` (`created_at`)
+);
@@ -0,0 +1,14 @@
+-- Final SIP response of each call, one attempt per call in carrier ASR/ACD statistics
+CREATE TABLE `carrier_sip_reports` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `call_id` INT UNSIGNED NOT NULL,
+  `provider_id` INT UNSIGNED NULL DEFAULT NULL,
+  `dial_prefix` VARCHAR(32) NOT NULL DEFAULT '',
+  `sip_status` SMALLINT UNSIGNED NOT NULL,
+  `pdd_ms` INT UNSIGNED NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `carrier_sip_reports_call_id_unique` (`call_id`),
+  KEY `carrier_sip_reports_provider_id_created_at_index` (`provider_id`, `created_at`)
+);
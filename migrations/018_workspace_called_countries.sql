@@ -0,0 +1,14 @@
+-- Destination countries each workspace has called and their approval
+CREATE TABLE `workspace_called_countries` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `country_code` VARCHAR(8) NOT NULL,
+  `first_number` VARCHAR(64) NOT NULL DEFAULT '',
+  `high_risk` TINYINT(1) NOT NULL DEFAULT 0,
+  `approved` TINYINT(1) NOT NULL DEFAULT 0,
+  `approved_at` DATETIME NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `workspace_called_countries_workspace_id_country_code_unique` (`workspace_id`, `country_code`)
+);
@@ -0,0 +1,42 @@
+-- Outbound fraud rules, the decisions taken on calls and workspace suspensions
+CREATE TABLE `fraud_rules` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NULL DEFAULT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `action` VARCHAR(16) NOT NULL,
+  `threshold` DECIMAL(12,2) NOT NULL DEFAULT 0,
+  `score` INT NOT NULL DEFAULT 0,
+  `params` TEXT NULL,
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `fraud_rules_workspace_id_index` (`workspace_id`)
+);
+
+CREATE TABLE `fraud_decisions` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `call_api_id` VARCHAR(255) NOT NULL DEFAULT '',
+  `extension` VARCHAR(64) NOT NULL DEFAULT '',
+  `destination` VARCHAR(64) NOT NULL DEFAULT '',
+  `action` VARCHAR(16) NOT NULL,
+  `score` INT NOT NULL DEFAULT 0,
+  `reasons` TEXT NOT NULL,
+  `suspended` TINYINT(1) NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `fraud_decisions_workspace_id_index` (`workspace_id`)
+);
+
+CREATE TABLE `workspace_suspensions` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `reason` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  `lifted_at` DATETIME NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `workspace_suspensions_workspace_id_lifted_at_index` (`workspace_id`, `lifted_at`)
+);
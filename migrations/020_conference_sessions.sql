@@ -0,0 +1,29 @@
+-- Conference sessions and the participants who joined them
+CREATE TABLE `conference_sessions` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `conference_id` INT UNSIGNED NOT NULL,
+  `workspace_id` INT UNSIGNED NOT NULL,
+  `started_at` DATETIME NOT NULL,
+  `ended_at` DATETIME NULL DEFAULT NULL,
+  `duration` INT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `conference_sessions_conference_id_ended_at_index` (`conference_id`, `ended_at`)
+);
+
+CREATE TABLE `conference_participants` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `session_id` INT UNSIGNED NOT NULL,
+  `conference_id` INT UNSIGNED NOT NULL,
+  `call_id` INT UNSIGNED NOT NULL,
+  `role` VARCHAR(16) NOT NULL,
+  `joined_at` DATETIME NOT NULL,
+  `left_at` DATETIME NULL DEFAULT NULL,
+  `duration` INT UNSIGNED NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NULL DEFAULT NULL,
+  `updated_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `conference_participants_session_id_left_at_index` (`session_id`, `left_at`),
+  KEY `conference_participants_call_id_left_at_index` (`call_id`, `left_at`)
+);
@@ -0,0 +1,11 @@
+-- Conference PINs, participant caps and schedule windows
+ALTER TABLE `conferences`
+  ADD COLUMN `max_participants` INT UNSIGNED NULL DEFAULT NULL,
+  ADD COLUMN `starts_at` DATETIME NULL DEFAULT NULL,
+  ADD COLUMN `ends_at` DATETIME NULL DEFAULT NULL,
+  ADD COLUMN `moderator_pin_hash` VARCHAR(255) NULL DEFAULT NULL,
+  ADD COLUMN `attendee_pin_hash` VARCHAR(255) NULL DEFAULT NULL;
+
+-- NULL means conferences of the plan have no participant cap
+ALTER TABLE `plans`
+  ADD COLUMN `conference_participant_limit` INT UNSIGNED NULL AFTER `extension_limit`;
@@ -0,0 +1,5 @@
+-- Checksum and retry bookkeeping of recording uploads
+ALTER TABLE `recordings`
+  ADD COLUMN `checksum` CHAR(64) NULL DEFAULT NULL AFTER `size`,
+  ADD COLUMN `upload_attempts` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `checksum`,
+  ADD COLUMN `upload_error` TEXT NULL AFTER `upload_attempts`;
@@ -0,0 +1,27 @@
+-- Prepaid balances are kept per workspace: credits are top ups of a workspace and every debit records
+-- the workspace it was made for, whichever member of the workspace made it.
+ALTER TABLE `users_credits`
+  ADD COLUMN `workspace_id` INT UNSIGNED NULL AFTER `user_id`,
+  ADD KEY `users_credits_workspace_id_index` (`workspace_id`);
+
+ALTER TABLE `users_debits`
+  ADD COLUMN `workspace_id` INT UNSIGNED NULL AFTER `user_id`,
+  ADD KEY `users_debits_workspace_id_created_at_index` (`workspace_id`, `created_at`);
+
+-- Credits made before the column existed belong to the workspace created by the user
+UPDATE `users_credits`
+  INNER JOIN `workspaces` ON `workspaces`.`creator_id` = `users_credits`.`user_id`
+  SET `users_credits`.`workspace_id` = `workspaces`.`id`
+  WHERE `users_credits`.`workspace_id` IS NULL;
+
+-- Debits made before the column existed belong to the workspace of their call,
+-- other debits are attributed to the workspace created by the user
+UPDATE `users_debits`
+  INNER JOIN `calls` ON `calls`.`id` = `users_debits`.`call_id`
+  SET `users_debits`.`workspace_id` = `calls`.`workspace_id`
+  WHERE `users_debits`.`workspace_id` IS NULL;
+
+UPDATE `users_debits`
+  INNER JOIN `workspaces` ON `workspaces`.`creator_id` = `users_debits`.`user_id`
+  SET `users_debits`.`workspace_id` = `workspaces`.`id`
+  WHERE `users_debits`.`workspace_id` IS NULL;
@@ -0,0 +1,17 @@
+-- Idempotency keys are chosen by clients, so they are only unique within the workspace that sent them.
+
+ALTER TABLE `users_debits`
+  DROP INDEX `users_debits_idempotency_key_unique`,
+  ADD UNIQUE KEY `users_debits_workspace_id_idempotency_key_unique` (`workspace_id`, `idempotency_key`);
+
+ALTER TABLE `calls`
+  DROP INDEX `calls_idempotency_key_unique`,
+  ADD UNIQUE KEY `calls_workspace_id_idempotency_key_unique` (`workspace_id`, `idempotency_key`);
+
+ALTER TABLE `recordings`
+  DROP INDEX `recordings_idempotency_key_unique`,
+  ADD UNIQUE KEY `recordings_workspace_id_idempotency_key_unique` (`workspace_id`, `idempotency_key`);
+
+ALTER TABLE `faxes`
+  DROP INDEX `faxes_idempotency_key_unique`,
+  ADD UNIQUE KEY `faxes_workspace_id_idempotency_key_unique` (`workspace_id`, `idempotency_key`);
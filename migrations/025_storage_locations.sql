@@ -0,0 +1,12 @@
+-- Recordings and faxes keep the backend, region and bucket they were stored in, so download URLs
+-- are signed against the right bucket after the storage_region of the workspace changes.
+
+ALTER TABLE `recordings`
+  ADD COLUMN `storage_backend` VARCHAR(32) NULL,
+  ADD COLUMN `storage_region` VARCHAR(64) NULL,
+  ADD COLUMN `storage_bucket` VARCHAR(255) NULL;
+
+ALTER TABLE `faxes`
+  ADD COLUMN `storage_backend` VARCHAR(32) NULL,
+  ADD COLUMN `storage_region` VARCHAR(64) NULL,
+  ADD COLUMN `storage_bucket` VARCHAR(255) NULL;
@@ -1,11 +1,28 @@
 package model
 
+import "time"
+
+const (
+	CallTypePSTN   = "PSTN"
+	CallTypeSIP    = "SIP"
+	CallTypeWebRTC = "WEBRTC"
+)
+
+// Leg types linking a call to its parent
+const (
+	LegTypeOriginal       = "original"
+	LegTypeForward        = "forward"
+	LegTypeTransfer       = "transfer"
+	LegTypeConferenceJoin = "conference_join"
+)
+
 type Call struct {
+	Id           int    `json:"id"`
 	From         string `json:"from"`
 	To           string `json:"to"`
 	Status       string `json:"status"`
 	Direction    string `json:"direction"`
-	Duration     string `json:"duration"`
+	Duration     int    `json:"duration"`
 	UserId       int    `json:"user_id"`
 	WorkspaceId  int    `json:"workspace_id"`
 	APIId        string `json:"api_id"`
@@ -16,14 +33,128 @@ type Call struct {
 	CreatedAt    string `json:"created_at"`
 	UpdatedAt    string `json:"updated_at"`
 	PlanSnapshot string `json:"plan_snapshot"`
+	ProviderId   int    `json:"provider_id"`
+	// media server handling the call, taken from source_ip at creation
+	MediaServerIp string `json:"media_server_ip"`
+	// legs created from another call point to it, the first leg is the original
+	ParentCallId int    `json:"parent_call_id"`
+	LegType      string `json:"leg_type"`
+
+	// call detail record fields, set from call updates
+	RingingAt        *string `json:"ringing_at"`
+	AnsweredAt       *string `json:"answered_at"`
+	EndedAt          *string `json:"ended_at"`
+	BillableDuration int     `json:"billable_duration"`
+	HangupCause      string  `json:"hangup_cause"`
+	SIPStatus        int     `json:"sip_status"`
+
+	IdempotencyKey string `json:"idempotency_key"`
 }
 
 type CallUpdate struct {
-	CallId   int    `json:"call_id"`
-	Status   string `json:"status"`
-	SourceIp string `json:"source_ip"`
+	CallId      int    `json:"call_id"`
+	Status      string `json:"status"`
+	SourceIp    string `json:"source_ip"`
+	HangupCause string `json:"hangup_cause"`
+	SIPStatus   int    `json:"sip_status"`
+	// time the media server saw the event in RFC3339, defaults to when it is received
+	Timestamp string `json:"timestamp"`
 }
 
 type CallRate struct {
-	CallRate float64
+	CallRate         float64 `json:"call_rate"`
+	CallType         string  `json:"call_type"`
+	Plan             string  `json:"plan"`
+	DialPrefix       string  `json:"dial_prefix"`
+	ProviderId       int     `json:"provider_id"`
+	RateRefId        int     `json:"rate_ref_id"`
+	RateDeckId       int     `json:"rate_deck_id"`
+	BillingIncrement int     `json:"billing_increment"`
+	MinimumDuration  int     `json:"minimum_duration"`
+	MinimumCharge    float64 `json:"minimum_charge"`
+}
+
+type CallEvent struct {
+	Id             int    `json:"id"`
+	CallId         int    `json:"call_id"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status"`
+	SourceIp       string `json:"source_ip"`
+	HangupCause    string `json:"hangup_cause"`
+	SIPStatus      int    `json:"sip_status"`
+	Accepted       bool   `json:"accepted"`
+	EventAt        string `json:"event_at"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type CallFilter struct {
+	WorkspaceId int
+	Direction   string
+	Status      string
+	FromPrefix  string
+	ToPrefix    string
+	StartedFrom *time.Time
+	StartedTo   *time.Time
+	ProviderId  int
+	SIPStatus   int
+	SortBy      string
+	Descending  bool
+	Cursor      string
+	Limit       int
+}
+
+type CallList struct {
+	Calls      []*Call `json:"calls"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+type ActiveCallCount struct {
+	WorkspaceId int  `json:"workspace_id"`
+	ActiveCalls int  `json:"active_calls"`
+	Limit       *int `json:"limit"`
+}
+
+type LiveCall struct {
+	*Call
+	ElapsedSeconds int  `json:"elapsed_seconds"`
+	Tracked        bool `json:"tracked"`
+	HangupPending  bool `json:"hangup_pending"`
+}
+
+type LiveCallFilter struct {
+	WorkspaceId   int
+	MediaServerIp string
+	ProviderId    int
+}
+
+// Call command types media servers act on
+const CallCommandHangup = "hangup"
+
+type CallCommand struct {
+	Id             int     `json:"id"`
+	CallId         int     `json:"call_id"`
+	CallAPIId      string  `json:"call_api_id"`
+	WorkspaceId    int     `json:"workspace_id"`
+	MediaServerIp  string  `json:"media_server_ip"`
+	Command        string  `json:"command"`
+	Reason         string  `json:"reason"`
+	RequestedBy    string  `json:"requested_by"`
+	Status         string  `json:"status"`
+	CreatedAt      string  `json:"created_at"`
+	AcknowledgedAt *string `json:"acknowledged_at"`
+}
+
+type CallLeg struct {
+	*Call
+	CostCents float64    `json:"cost_cents"`
+	Legs      []*CallLeg `json:"legs"`
+}
+
+type CallLegTree struct {
+	Root                  *CallLeg `json:"root"`
+	LegCount              int      `json:"leg_count"`
+	TotalDuration         int      `json:"total_duration"`
+	TotalBillableDuration int      `json:"total_billable_duration"`
+	TotalCostCents        float64  `json:"total_cost_cents"`
 }
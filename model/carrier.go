@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type SIPReport struct {
+	SIPCallId string `json:"callid"`
+	Status    int    `json:"status"`
+	// post dial delay in milliseconds, nil when the media server did not measure it
+	PDDMs *int `json:"pdd_ms"`
+}
+
+type CarrierStatsFilter struct {
+	ProviderId int
+	DialPrefix string
+	Start      time.Time
+	End        time.Time
+	ByPrefix   bool
+	Interval   string
+}
+
+type CarrierStats struct {
+	ProviderId   int         `json:"provider_id"`
+	DialPrefix   string      `json:"dial_prefix"`
+	WindowStart  string      `json:"window_start"`
+	Attempts     int         `json:"attempts"`
+	Answered     int         `json:"answered"`
+	ASR          float64     `json:"asr"`
+	ACD          float64     `json:"acd"`
+	AvgPDDMs     float64     `json:"avg_pdd_ms"`
+	FailureCodes map[int]int `json:"failure_codes"`
+}
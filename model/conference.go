@@ -1,7 +1,54 @@
 package model
 
+import "time"
+
+// PINs are only accepted as input, the bcrypt hashes are stored instead. A stored PIN is removed with its clear flag
 type Conference struct {
-	Name        string `json:"name"`
-	WorkspaceId int    `json:"workspace_id"`
-	APIId       string `json:"api_id"`
+	Id                int        `json:"id"`
+	Name              string     `json:"name"`
+	WorkspaceId       int        `json:"workspace_id"`
+	APIId             string     `json:"api_id"`
+	MaxParticipants   *int       `json:"max_participants"`
+	StartsAt          *time.Time `json:"starts_at"`
+	EndsAt            *time.Time `json:"ends_at"`
+	ModeratorPin      string     `json:"moderator_pin,omitempty"`
+	AttendeePin       string     `json:"attendee_pin,omitempty"`
+	ClearModeratorPin bool       `json:"clear_moderator_pin,omitempty"`
+	ClearAttendeePin  bool       `json:"clear_attendee_pin,omitempty"`
+	HasModeratorPin   bool       `json:"has_moderator_pin"`
+	HasAttendeePin    bool       `json:"has_attendee_pin"`
+	ModeratorPinHash  string     `json:"-"`
+	AttendeePinHash   string     `json:"-"`
+}
+
+type ConferenceAdmission struct {
+	Allowed      bool   `json:"allowed"`
+	Role         string `json:"role,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	Participants int    `json:"participants"`
+	Limit        *int   `json:"limit"`
+}
+
+// A session lasts from the first participant joining until the last one leaves
+type ConferenceSession struct {
+	Id                 int        `json:"id"`
+	ConferenceId       int        `json:"conference_id"`
+	WorkspaceId        int        `json:"workspace_id"`
+	StartedAt          time.Time  `json:"started_at"`
+	EndedAt            *time.Time `json:"ended_at"`
+	Duration           int        `json:"duration"`
+	Participants       int        `json:"participants"`
+	ParticipantSeconds int        `json:"participant_seconds"`
+}
+
+type ConferenceParticipant struct {
+	Id           int        `json:"id"`
+	SessionId    int        `json:"session_id"`
+	ConferenceId int        `json:"conference_id"`
+	CallId       int        `json:"call_id"`
+	CallAPIId    string     `json:"call_api_id"`
+	Role         string     `json:"role"`
+	JoinedAt     time.Time  `json:"joined_at"`
+	LeftAt       *time.Time `json:"left_at"`
+	Duration     int        `json:"duration"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type CalledCountry struct {
+	WorkspaceId int        `json:"workspace_id"`
+	CountryCode string     `json:"country_code"`
+	FirstNumber string     `json:"first_number"`
+	HighRisk    bool       `json:"high_risk"`
+	Approved    bool       `json:"approved"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ApprovedAt  *time.Time `json:"approved_at"`
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type Debit struct {
 	CreatedAt    string  `json:"created_at"`
 	UpdatedAt    string  `json:"updated_at"`
@@ -10,17 +12,28 @@ type Debit struct {
 	Balance      int     `json:"balance"`
 	Status       string  `json:"status"`
 	Seconds      float64 `json:"seconds"`
+	CallId       int     `json:"call_id"`
 	PlanSnapshot string  `json:"plan_snapshot"`
 
+	// billing audit fields
+	BillableSeconds  int     `json:"billable_seconds"`
+	BillingIncrement int     `json:"billing_increment"`
+	MinimumDuration  int     `json:"minimum_duration"`
+	Rate             float64 `json:"rate"`
+
 	//extra request field
 	WorkspaceId int    `json:"workspace_id"`
 	Number      string `json:"number"`
 	Type        string `json:"type"`
+	Direction   string `json:"direction"`
+
+	IdempotencyKey string `json:"idempotency_key"`
 }
 
 type DebitAPIParams struct {
 	Length          int     `json:"length"`
 	RecordingLength float64 `json:"recording_length"`
+	Quantity        float64 `json:"quantity"`
 }
 type DebitAPI struct {
 	UserId      int            `json:"user_id"`
@@ -28,4 +41,42 @@ type DebitAPI struct {
 	Type        string         `json:"type"`
 	Source      string         `json:"source"`
 	Params      DebitAPIParams `json:"params"`
+
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+type CallAuthorization struct {
+	WorkspaceId  int       `json:"workspace_id"`
+	Destination  string    `json:"destination"`
+	Direction    string    `json:"direction"`
+	Allowed      bool      `json:"allowed"`
+	Reason       string    `json:"reason"`
+	BalanceCents float64   `json:"balance_cents"`
+	MaxDuration  int       `json:"max_duration"`
+	Rate         *CallRate `json:"rate"`
+}
+
+type UsageSummaryLine struct {
+	Category        string  `json:"category"`
+	Source          string  `json:"source"`
+	Direction       string  `json:"direction"`
+	UsageType       string  `json:"usage_type"`
+	Count           int     `json:"count"`
+	Seconds         float64 `json:"seconds"`
+	BillableSeconds int     `json:"billable_seconds"`
+	Quantity        float64 `json:"quantity"`
+	Cents           float64 `json:"cents"`
+}
+
+type UsageSummary struct {
+	WorkspaceId         int                 `json:"workspace_id"`
+	Plan                string              `json:"plan"`
+	PeriodStart         time.Time           `json:"period_start"`
+	PeriodEnd           time.Time           `json:"period_end"`
+	Lines               []*UsageSummaryLine `json:"lines"`
+	UsageCents          float64             `json:"usage_cents"`
+	BaseFeeCents        float64             `json:"base_fee_cents"`
+	TotalCents          float64             `json:"total_cents"`
+	ProjectedUsageCents float64             `json:"projected_usage_cents"`
+	ProjectedTotalCents float64             `json:"projected_total_cents"`
 }
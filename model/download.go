@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type DownloadURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Where an object was stored, kept with the object so later changes to the workspace region do not lose it
+type StorageLocation struct {
+	Backend string `json:"backend"`
+	Region  string `json:"region"`
+	Bucket  string `json:"bucket"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Rule parameters besides the threshold are stored as JSON in fraud_rules.params
+type FraudRule struct {
+	Id          int      `json:"id"`
+	WorkspaceId *int     `json:"workspace_id"`
+	Type        string   `json:"type"`
+	Action      string   `json:"action"`
+	Threshold   float64  `json:"threshold"`
+	Score       int      `json:"score"`
+	Prefixes    []string `json:"prefixes,omitempty"`
+	StartHour   int      `json:"start_hour,omitempty"`
+	EndHour     int      `json:"end_hour,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+}
+
+type FraudCheck struct {
+	WorkspaceId int
+	CallAPIId   string
+	Extension   string
+	Destination string
+	At          time.Time
+}
+
+// Recent outbound activity of a workspace, counts do not include the call being checked.
+// Its destination country is only recorded once the call is let in, so NewCountriesLastHour counts earlier calls only
+type FraudActivity struct {
+	WorkspaceCallsLastMinute int
+	ExtensionCallsLastMinute int
+	SpendLastHourCents       float64
+	NewCountriesLastHour     int
+}
+
+type FraudDecision struct {
+	Id          int       `json:"id"`
+	WorkspaceId int       `json:"workspace_id"`
+	CallAPIId   string    `json:"call_api_id"`
+	Extension   string    `json:"extension"`
+	Destination string    `json:"destination"`
+	Action      string    `json:"action"`
+	Score       int       `json:"score"`
+	Reasons     []string  `json:"reasons"`
+	Suspended   bool      `json:"suspended"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WorkspaceSuspension struct {
+	WorkspaceId int        `json:"workspace_id"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LiftedAt    *time.Time `json:"lifted_at"`
+}
@@ -6,7 +6,7 @@ type Log struct {
 	Title       string  `json:"title"`
 	Report      string  `json:"report"`
 	FlowId      int     `json:"flow_id"`
-	Level       *string `json:"report"`
+	Level       *string `json:"level"`
 	From        *string `json:"from"`
 	To          *string `json:"to"`
 }
@@ -20,4 +20,6 @@ type LogRoutine struct {
 	Level       string
 	From        string
 	To          string
+	// set when the caller already notified the user by email
+	SkipEmail bool
 }
@@ -0,0 +1,20 @@
+package model
+
+type UsageType struct {
+	Name      string  `json:"name"`
+	Unit      string  `json:"unit"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+type UsageEvent struct {
+	Id               int64   `json:"id"`
+	WorkspaceId      int     `json:"workspace_id"`
+	UserId           int     `json:"user_id"`
+	Type             string  `json:"type"`
+	Quantity         float64 `json:"quantity"`
+	BillableQuantity float64 `json:"billable_quantity"`
+	UnitPrice        float64 `json:"unit_price"`
+	Cents            float64 `json:"cents"`
+	DebitId          int64   `json:"debit_id"`
+	IdempotencyKey   string  `json:"idempotency_key"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// Plan limits that are nil are unlimited
+type Plan struct {
+	Name                  string  `json:"name"`
+	MonthlyFee            float64 `json:"monthly_fee"`
+	RecordingStorageMB    *int    `json:"recording_storage_mb"`
+	FaxLimit              *int    `json:"fax_limit"`
+	ConcurrentCallLimit   *int    `json:"concurrent_call_limit"`
+	ExtensionLimit        *int    `json:"extension_limit"`
+	ConferenceLimit       *int    `json:"conference_participant_limit"`
+	TTSCharactersIncluded int     `json:"tts_characters_included"`
+	STTSecondsIncluded    int     `json:"stt_seconds_included"`
+	TrialDays             int     `json:"trial_days"`
+}
@@ -0,0 +1,28 @@
+package model
+
+type QualityReport struct {
+	Id            int     `json:"id"`
+	CallAPIId     string  `json:"call_api_id"`
+	CallId        int     `json:"call_id"`
+	Leg           string  `json:"leg"`
+	MOS           float64 `json:"mos"`
+	JitterMs      float64 `json:"jitter_ms"`
+	PacketLossPct float64 `json:"packet_loss_pct"`
+	RTTMs         float64 `json:"rtt_ms"`
+	Codec         string  `json:"codec"`
+	ProviderId    int     `json:"provider_id"`
+	MediaServerIp string  `json:"media_server_ip"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+type QualityStats struct {
+	GroupBy          string  `json:"group_by"`
+	Key              string  `json:"key"`
+	Reports          int     `json:"reports"`
+	AvgMOS           float64 `json:"avg_mos"`
+	MinMOS           float64 `json:"min_mos"`
+	AvgJitterMs      float64 `json:"avg_jitter_ms"`
+	AvgPacketLossPct float64 `json:"avg_packet_loss_pct"`
+	AvgRTTMs         float64 `json:"avg_rtt_ms"`
+	PoorReports      int     `json:"poor_reports"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type RateDeck struct {
+	Id            int              `json:"id"`
+	ProviderId    int              `json:"provider_id"`
+	Name          string           `json:"name"`
+	EffectiveFrom time.Time        `json:"effective_from"`
+	EntryCount    int              `json:"entry_count"`
+	Active        bool             `json:"active"`
+	Entries       []*RateDeckEntry `json:"-"`
+}
+
+type RateDeckEntry struct {
+	DialPrefix    string    `json:"dial_prefix"`
+	Country       string    `json:"country"`
+	Rate          float64   `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// Decks with warnings are still imported, the warnings point at entries worth a second look
+type RateDeckImport struct {
+	Decks    []*RateDeck `json:"decks"`
+	Warnings []string    `json:"warnings"`
+}
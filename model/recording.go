@@ -1,18 +1,23 @@
 package model
 
 type Recording struct {
-	Id                 int       `json:"id"`
-	UserId             int       `json:"user_id"`
-	CallId             *int      `json:"call_id"`
-	Size               int       `json:"size"`
-	WorkspaceId        int       `json:"workspace_id"`
-	APIId              string    `json:"api_id"`
-	Tags               *[]string `json:"tags"`
-	Trim               bool      `json:"trim"`
-	TranscriptionReady bool      `json:"transcription_ready"`
-	TranscriptionText  string    `json:"transcription_text"`
-	StorageId          string    `json:"storage_id"`
-	StorageServerIp    string    `json:"storage_server_ip"`
+	Id                 int              `json:"id"`
+	UserId             int              `json:"user_id"`
+	CallId             *int             `json:"call_id"`
+	Size               int              `json:"size"`
+	Status             string           `json:"status"`
+	Uri                string           `json:"uri"`
+	Checksum           string           `json:"checksum"`
+	Location           *StorageLocation `json:"location"`
+	WorkspaceId        int              `json:"workspace_id"`
+	APIId              string           `json:"api_id"`
+	Tags               *[]string        `json:"tags"`
+	Trim               bool             `json:"trim"`
+	TranscriptionReady bool             `json:"transcription_ready"`
+	TranscriptionText  string           `json:"transcription_text"`
+	StorageId          string           `json:"storage_id"`
+	StorageServerIp    string           `json:"storage_server_ip"`
+	IdempotencyKey     string           `json:"idempotency_key"`
 }
 
 type RecordingTranscription struct {
@@ -0,0 +1,13 @@
+package plan
+
+import "lineblocs.com/api/model"
+
+/*
+Interface of Plan Store.
+Implementation of Plan Store is located /store/plan
+*/
+type Store interface {
+	GetPlan(*model.Workspace) (*model.Plan, error)
+	GetPlanByName(string) (*model.Plan, error)
+	GetPlans() ([]*model.Plan, error)
+}
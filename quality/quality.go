@@ -0,0 +1,26 @@
+package quality
+
+import (
+	"time"
+
+	"lineblocs.com/api/model"
+)
+
+/*
+Interface of Quality Store.
+Implementation of Quality Store is located /store/quality
+*/
+type Store interface {
+	CreateQualityReport(*model.QualityReport) (int64, error)
+	GetQualityReports(string) ([]*model.QualityReport, error)
+	GetQualityStats(string, time.Time, time.Time) ([]*model.QualityStats, error)
+}
+
+// Ways quality reports can be aggregated
+const (
+	GroupByProvider    = "provider"
+	GroupByMediaServer = "media_server"
+)
+
+// Reports with a MOS below this are counted as poor quality
+const PoorMOS = 3.5
@@ -0,0 +1,13 @@
+package rating
+
+import "lineblocs.com/api/model"
+
+/*
+Interface of Rating Store.
+Implementation of Rating Store is located /store/rating
+*/
+type Store interface {
+	LookupBestCallRate(*model.Workspace, string, string) (*model.CallRate, error)
+	ImportRateDeck(int, string, []*model.RateDeckEntry) ([]*model.RateDeck, error)
+	GetRateDecks(int) ([]*model.RateDeck, error)
+}
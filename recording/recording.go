@@ -1,6 +1,10 @@
 package recording
 
-import "lineblocs.com/api/model"
+import (
+	"time"
+
+	"lineblocs.com/api/model"
+)
 
 /*
 Interface of Recording Store.
@@ -9,7 +13,21 @@ Implementation of Recording Store is located /store/recording
 type Store interface {
 	CreateRecording(*model.Workspace, *model.Recording) (int64, error)
 	GetRecordingFromDB(int) (*model.Recording, error)
+	GetRecordingByAPIId(string) (*model.Recording, error)
 	GetRecordingSpace(int) (int, error)
-	UpdateRecording(string, string, int64, int) error
+	StartRecordingUpload(int, int, int64, *int) error
+	FailRecordingUpload(int, int, error) error
+	CompleteRecordingUpload(int, string, int64, string, int, model.StorageLocation) error
 	UpdateRecordingTranscription(*model.RecordingTranscription) error
 }
+
+// Recording statuses, a recording is only completed once its file is stored
+const (
+	StatusStarted      = "started"
+	StatusUploading    = "uploading"
+	StatusUploadFailed = "upload_failed"
+	StatusCompleted    = "completed"
+)
+
+// An upload still marked uploading after this long was abandoned, for example by a restart, and may be started again
+const UploadTimeout = 30 * time.Minute
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"lineblocs.com/api/utils"
+)
+
+func newTestLocalBackend(t *testing.T) *localBackend {
+	backend, err := newLocalBackend(Config{
+		LocalDir:    t.TempDir(),
+		SigningKey:  "secret",
+		DownloadURL: "https://api.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestLocalUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"nested key", "recordings/1/a.wav", false},
+		{"parent directory", "../a.wav", true},
+		{"escapes through a folder", "recordings/../../a.wav", true},
+		{"storage directory itself", ".", true},
+		{"cleaned inside the directory", "recordings/../faxes/a.pdf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestLocalBackend(t)
+			err := backend.Upload(context.Background(), tt.key, strings.NewReader("data"), "audio/wav", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(filepath.Join(filepath.Dir(backend.dir), "a.wav")); !os.IsNotExist(err) {
+					t.Errorf("object was written outside the storage directory")
+				}
+				return
+			}
+			data, err := ioutil.ReadFile(filepath.Join(backend.dir, filepath.FromSlash(tt.key)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "data" {
+				t.Errorf("stored %q", data)
+			}
+		})
+	}
+}
+
+func TestLocalUploadCancelled(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := backend.Upload(ctx, "recordings/a.wav", strings.NewReader("data"), "audio/wav", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(backend.dir, "recordings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("partial upload left %d files behind", len(entries))
+	}
+}
+
+func TestLocalUploadChecksumMismatch(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	sum := sha256.Sum256([]byte("other data"))
+	err := backend.Upload(context.Background(), "recordings/a.wav", strings.NewReader("data"), "audio/wav", hex.EncodeToString(sum[:]))
+	if err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(backend.dir, "recordings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("corrupted upload left %d files behind", len(entries))
+	}
+}
+
+func TestLocalOpenSigned(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	if err := backend.Upload(context.Background(), "recordings/a.wav", strings.NewReader("data"), "audio/wav", ""); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		key       string
+		expires   int64
+		signature string
+		wantErr   error
+	}{
+		{"valid", "recordings/a.wav", future, backend.sign("recordings/a.wav", future), nil},
+		{"expired", "recordings/a.wav", past, backend.sign("recordings/a.wav", past), utils.ErrSignedURLExpired},
+		{"signature of another key", "recordings/a.wav", future, backend.sign("recordings/b.wav", future), utils.ErrInvalidSignature},
+		{"expiry extended", "recordings/a.wav", future + 1, backend.sign("recordings/a.wav", future), utils.ErrInvalidSignature},
+		{"not hex", "recordings/a.wav", future, "not-a-signature", utils.ErrInvalidSignature},
+		{"empty signature", "recordings/a.wav", future, "", utils.ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := backend.OpenSigned(tt.key, tt.expires, tt.signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer file.Close()
+			data, err := ioutil.ReadAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "data" {
+				t.Errorf("read %q", data)
+			}
+		})
+	}
+}
+
+func TestLocalOpenSignedTraversal(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	outside := filepath.Join(filepath.Dir(backend.dir), "secret.txt")
+	if err := ioutil.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A valid signature does not let a key leave the storage directory
+	expires := time.Now().Add(time.Hour).Unix()
+	file, err := backend.OpenSigned("../secret.txt", expires, backend.sign("../secret.txt", expires))
+	if err == nil {
+		file.Close()
+		t.Fatal("opened a file outside the storage directory")
+	}
+	if _, err := backend.SignedURL("../secret.txt", time.Minute); err == nil {
+		t.Error("signed a key outside the storage directory")
+	}
+}
+
+func TestLocalOpenSignedWithoutKey(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	backend.signingKey = nil
+	if _, err := backend.OpenSigned("recordings/a.wav", time.Now().Add(time.Hour).Unix(), ""); !errors.Is(err, utils.ErrInvalidSignature) {
+		t.Fatalf("err = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := backend.SignedURL("recordings/a.wav", time.Minute); err == nil {
+		t.Error("signed a URL without a signing key")
+	}
+}
+
+func TestLocalSignedURLRoundTrip(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	key := "faxes/1/fax 1&2.pdf"
+	if err := backend.Upload(context.Background(), key, strings.NewReader("fax"), "application/pdf", ""); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := backend.SignedURL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme+"://"+parsed.Host+parsed.Path != "https://api.example.com"+DownloadPath {
+		t.Errorf("url = %s, want the download route", signed)
+	}
+	query := parsed.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("key") != key {
+		t.Errorf("key = %q, want %q", query.Get("key"), key)
+	}
+
+	file, err := backend.OpenSigned(query.Get("key"), expires, query.Get("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fax" {
+		t.Errorf("read %q", data)
+	}
+
+	if _, err := backend.OpenSigned("faxes/1/other.pdf", expires, query.Get("signature")); !errors.Is(err, utils.ErrInvalidSignature) {
+		t.Errorf("signature was accepted for another key: %v", err)
+	}
+}
+
+func TestLocalURI(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	if got, want := backend.URI("recordings/a.wav"), "file://"+filepath.ToSlash(backend.dir)+"/recordings/a.wav"; got != want {
+		t.Errorf("URI = %s, want %s", got, want)
+	}
+	backend.publicURL = "https://files.example.com"
+	if got := backend.URI("recordings/a.wav"); got != "https://files.example.com/recordings/a.wav" {
+		t.Errorf("URI = %s, want the public URL", got)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Backend storing objects in AWS S3 or an S3 compatible service such as MinIO
+*/
+type s3Backend struct {
+	kind      string
+	bucket    string
+	region    string
+	endpoint  string
+	pathStyle bool
+	client    *s3.S3
+	uploader  *s3manager.Uploader
+}
+
+func newS3Backend(cfg Config) (*s3Backend, error) {
+	awsConfig := &aws.Config{Region: aws.String(cfg.Region)}
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(cfg.PathStyle)
+	}
+	if cfg.AccessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("S3 session err: %s", err)
+	}
+	return &s3Backend{
+		kind:      cfg.Type,
+		bucket:    cfg.Bucket,
+		region:    cfg.Region,
+		endpoint:  cfg.Endpoint,
+		pathStyle: cfg.PathStyle,
+		client:    s3.New(sess),
+		uploader:  s3manager.NewUploader(sess),
+	}, nil
+}
+
+func (b *s3Backend) Upload(ctx context.Context, key string, body io.Reader, contentType string, checksum string) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	// S3 verifies every part against its checksum, S3 compatible services may not support it
+	if b.endpoint == "" {
+		input.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+	}
+	// The service rejects a single part upload that does not match, the uploader ignores it for multipart uploads
+	if checksum != "" {
+		sum, err := hex.DecodeString(checksum)
+		if err != nil {
+			return fmt.Errorf("invalid checksum %q", checksum)
+		}
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum))
+	}
+	result, err := b.uploader.UploadWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to upload file, %v", err)
+	}
+	utils.Log(logrus.InfoLevel, fmt.Sprintf("file uploaded to, %s\n", aws.StringValue(&result.Location)))
+	return nil
+}
+
+func (b *s3Backend) URI(key string) string {
+	if b.endpoint == "" {
+		return "https://" + b.bucket + ".s3." + b.region + ".amazonaws.com/" + key
+	}
+	endpoint, err := url.Parse(b.endpoint)
+	if err != nil || b.pathStyle || endpoint.Host == "" {
+		return b.endpoint + "/" + b.bucket + "/" + key
+	}
+	return endpoint.Scheme + "://" + b.bucket + "." + endpoint.Host + "/" + key
+}
+
+// Presigned GET requests keep the bucket private
+func (b *s3Backend) SignedURL(key string, expires time.Duration) (string, error) {
+	req, _ := b.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+func (b *s3Backend) Location() model.StorageLocation {
+	return model.StorageLocation{Backend: b.kind, Region: b.region, Bucket: b.bucket}
+}
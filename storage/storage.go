@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Interface of object storage backends.
+Implementations are located /storage/s3.go and /storage/local.go
+Upload is given the expected hex SHA-256 of the body, or "" when it is not known, and must refuse a body that does not match
+*/
+type Backend interface {
+	Upload(ctx context.Context, key string, body io.Reader, contentType string, checksum string) error
+	URI(key string) string
+	SignedURL(key string, expires time.Duration) (string, error)
+	Location() model.StorageLocation
+}
+
+/*
+Implemented by backends whose signed URLs are served by the API itself
+*/
+type SignedOpener interface {
+	OpenSigned(key string, expires int64, signature string) (*os.File, error)
+}
+
+// Backend types
+const (
+	TypeS3           = "s3"
+	TypeS3Compatible = "s3-compatible"
+	TypeLocal        = "local"
+)
+
+// Folders objects are stored in
+const (
+	RecordingsFolder = "recordings"
+	FaxesFolder      = "faxes"
+)
+
+// Deployment defaults, kept from when the bucket was hard coded
+const (
+	DefaultBucket   = "lineblocs"
+	DefaultRegion   = "ca-central-1"
+	DefaultLocalDir = "storage"
+)
+
+// Lifetime of signed download URLs, S3 does not accept presigned URLs valid for more than 7 days
+const (
+	DefaultURLExpiry = 15 * time.Minute
+	MaxURLExpiry     = 7 * 24 * time.Hour
+)
+
+// API route serving signed downloads of the local backend
+const DownloadPath = "/storage/download"
+
+type Config struct {
+	Type        string
+	Bucket      string
+	Region      string
+	Endpoint    string
+	PathStyle   bool
+	AccessKey   string
+	SecretKey   string
+	LocalDir    string
+	PublicURL   string
+	SigningKey  string
+	DownloadURL string
+}
+
+/*
+Todo : Read the storage configuration of the deployment from the environment
+Output: Config
+*/
+func ConfigFromEnv() Config {
+	pathStyle, _ := strconv.ParseBool(utils.Config("STORAGE_PATH_STYLE"))
+	return Config{
+		Type:        utils.ReadEnv("STORAGE_BACKEND", TypeS3),
+		Bucket:      utils.ReadEnv("STORAGE_BUCKET", DefaultBucket),
+		Region:      utils.ReadEnv("STORAGE_REGION", DefaultRegion),
+		Endpoint:    utils.Config("STORAGE_ENDPOINT"),
+		PathStyle:   pathStyle,
+		AccessKey:   utils.Config("STORAGE_ACCESS_KEY"),
+		SecretKey:   utils.Config("STORAGE_SECRET_KEY"),
+		LocalDir:    utils.ReadEnv("STORAGE_LOCAL_DIR", DefaultLocalDir),
+		PublicURL:   strings.TrimSuffix(utils.Config("STORAGE_PUBLIC_URL"), "/"),
+		SigningKey:  utils.Config("STORAGE_SIGNING_KEY"),
+		DownloadURL: strings.TrimSuffix(utils.Config("STORAGE_DOWNLOAD_URL"), "/"),
+	}
+}
+
+/*
+Input: Config
+Todo : Create the backend of the configured type
+Output: First Value: Backend, Second Value: error
+*/
+func New(cfg Config) (Backend, error) {
+	switch cfg.Type {
+	case TypeS3:
+		cfg.Endpoint = ""
+		cfg.PathStyle = false
+		return newS3Backend(cfg)
+	case TypeS3Compatible:
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("STORAGE_ENDPOINT is required for %s storage", TypeS3Compatible)
+		}
+		return newS3Backend(cfg)
+	case TypeLocal:
+		return newLocalBackend(cfg)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Type)
+}
+
+/*
+Todo : Get the lifetime of signed download URLs from STORAGE_URL_EXPIRY in seconds
+Output: expiry duration
+*/
+func URLExpiry() time.Duration {
+	seconds, err := strconv.Atoi(utils.Config("STORAGE_URL_EXPIRY"))
+	if err != nil || seconds <= 0 {
+		return DefaultURLExpiry
+	}
+	return ClampURLExpiry(time.Duration(seconds) * time.Second)
+}
+
+/*
+Input: requested expiry
+Todo : Keep the expiry of a signed URL within what every backend accepts
+Output: expiry duration
+*/
+func ClampURLExpiry(expires time.Duration) time.Duration {
+	if expires > MaxURLExpiry {
+		return MaxURLExpiry
+	}
+	return expires
+}
+
+/*
+Input: folder, name
+Todo : Build the key of an object
+Output: object key
+*/
+func Key(folder string, name string) string {
+	return folder + "/" + name
+}
+
+/*
+Provider hands out one backend per region. The deployment config is used as is for the default region,
+other regions get their own bucket from STORAGE_BUCKET_<REGION> when it is set
+*/
+type Provider struct {
+	config   Config
+	mu       sync.Mutex
+	backends map[string]Backend
+}
+
+func NewProvider(cfg Config) *Provider {
+	return &Provider{
+		config:   cfg,
+		backends: make(map[string]Backend),
+	}
+}
+
+/*
+Input: region, empty for the deployment default
+Todo : Get the backend of a region, creating it on first use
+Output: First Value: Backend, Second Value: error
+*/
+func (p *Provider) ForRegion(region string) (Backend, error) {
+	if region == "" || p.config.Type == TypeLocal {
+		region = p.config.Region
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if backend, ok := p.backends[region]; ok {
+		return backend, nil
+	}
+
+	cfg := p.config
+	if region != cfg.Region {
+		cfg.Region = region
+		envKey := "STORAGE_BUCKET_" + strings.ToUpper(strings.ReplaceAll(region, "-", "_"))
+		if bucket := utils.Config(envKey); bucket != "" {
+			cfg.Bucket = bucket
+		}
+	}
+	backend, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.backends[region] = backend
+	return backend, nil
+}
+
+/*
+Input: StorageLocation model of a stored object
+Todo : Get the backend an object was stored with, whatever the current region settings of its workspace are
+Output: First Value: Backend, Second Value: error
+*/
+func (p *Provider) ForLocation(location model.StorageLocation) (Backend, error) {
+	cacheKey := location.Backend + "|" + location.Region + "|" + location.Bucket
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if backend, ok := p.backends[cacheKey]; ok {
+		return backend, nil
+	}
+
+	cfg := p.config
+	cfg.Type = location.Backend
+	cfg.Region = location.Region
+	cfg.Bucket = location.Bucket
+	backend, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.backends[cacheKey] = backend
+	return backend, nil
+}
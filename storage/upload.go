@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/utils"
+)
+
+// Upload retry defaults, the delay doubles after every failed attempt
+const (
+	DefaultUploadAttempts = 3
+	DefaultRetryDelay     = time.Second
+)
+
+type UploadResult struct {
+	Key      string
+	URI      string
+	Size     int64
+	Checksum string
+	Attempts int
+}
+
+/*
+Todo : Get the number of upload attempts from STORAGE_UPLOAD_ATTEMPTS
+Output: number of attempts, at least 1
+*/
+func UploadAttempts() int {
+	attempts, err := strconv.Atoi(utils.Config("STORAGE_UPLOAD_ATTEMPTS"))
+	if err != nil || attempts < 1 {
+		return DefaultUploadAttempts
+	}
+	return attempts
+}
+
+/*
+Input: context, Backend, key, content type, expected size, function opening the source, attempts
+Todo : Compute the SHA-256 checksum of the source, then upload it with that checksum so the backend refuses a corrupted
+body. An attempt fails when the source has fewer or more bytes than expected, the upload fails or the bytes uploaded do
+not match the checksum, failed attempts are retried with a fresh source
+Output: First Value: UploadResult with the checksum and the attempts used, Second Value: error of the last attempt
+*/
+func UploadVerified(ctx context.Context, backend Backend, key string, contentType string, size int64, open func() (io.ReadCloser, error), attempts int) (*UploadResult, error) {
+	result := &UploadResult{Key: key, URI: backend.URI(key)}
+	delay := DefaultRetryDelay
+	var err error
+	for result.Attempts < attempts {
+		result.Attempts++
+		result.Size, result.Checksum, err = uploadOnce(ctx, backend, key, contentType, size, open)
+		if err == nil {
+			return result, nil
+		}
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Upload of %s failed on attempt %d/%d: %s", key, result.Attempts, attempts, err.Error()))
+		if result.Attempts == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return result, err
+}
+
+func uploadOnce(ctx context.Context, backend Backend, key string, contentType string, size int64, open func() (io.ReadCloser, error)) (int64, string, error) {
+	read, checksum, err := checksumSource(open)
+	if err != nil {
+		return 0, "", err
+	}
+	if read != size {
+		return read, checksum, fmt.Errorf("read %d bytes, expected %d", read, size)
+	}
+
+	src, err := open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer src.Close()
+
+	// The backend verifies the checksum where it can, the bytes sent are checked here as well
+	reader := &checksumReader{r: src, hash: sha256.New()}
+	if err := backend.Upload(ctx, key, reader, contentType, checksum); err != nil {
+		return 0, "", err
+	}
+	uploaded := hex.EncodeToString(reader.hash.Sum(nil))
+	if reader.size != size || uploaded != checksum {
+		return reader.size, uploaded, fmt.Errorf("uploaded %d bytes with checksum %s, expected %d bytes with checksum %s", reader.size, uploaded, size, checksum)
+	}
+	return reader.size, checksum, nil
+}
+
+// Read the whole source once to get its size and checksum before uploading it
+func checksumSource(open func() (io.ReadCloser, error)) (int64, string, error) {
+	src, err := open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Hashes and counts everything read through it
+type checksumReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("USE_DOTENV", "off")
+	utils.InitLogrus()
+	os.Exit(m.Run())
+}
+
+// Backend failing its first uploads, every upload drains the body like a real backend would
+type fakeBackend struct {
+	failures int
+	uploads  int
+	stored   []byte
+	checksum string
+}
+
+func (b *fakeBackend) Upload(ctx context.Context, key string, body io.Reader, contentType string, checksum string) error {
+	b.uploads++
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if b.uploads <= b.failures {
+		return errors.New("connection reset")
+	}
+	b.stored = data
+	b.checksum = checksum
+	return nil
+}
+
+func (b *fakeBackend) URI(key string) string {
+	return "fake://" + key
+}
+
+func (b *fakeBackend) SignedURL(key string, expires time.Duration) (string, error) {
+	return "fake://" + key, nil
+}
+
+func (b *fakeBackend) Location() model.StorageLocation {
+	return model.StorageLocation{Backend: "fake"}
+}
+
+func opener(data string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(data)), nil
+	}
+}
+
+func TestUploadVerified(t *testing.T) {
+	body := "recording bytes"
+	sum := sha256.Sum256([]byte(body))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name         string
+		failures     int
+		size         int64
+		attempts     int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"first attempt", 0, int64(len(body)), 3, false, 1},
+		{"retried after a failed attempt", 1, int64(len(body)), 3, false, 2},
+		{"every attempt fails", 1, int64(len(body)), 1, true, 1},
+		{"fewer bytes than expected", 0, int64(len(body)) + 1, 1, true, 1},
+		{"more bytes than expected", 0, int64(len(body)) - 1, 1, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeBackend{failures: tt.failures}
+			result, err := UploadVerified(context.Background(), backend, "recordings/a.wav", "audio/wav", tt.size, opener(body), tt.attempts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", result.Attempts, tt.wantAttempts)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Checksum != checksum || backend.checksum != checksum {
+				t.Errorf("checksum = %s, backend got %s, want %s", result.Checksum, backend.checksum, checksum)
+			}
+			if result.Size != int64(len(body)) || string(backend.stored) != body {
+				t.Errorf("stored %q (%d bytes), want %q", backend.stored, result.Size, body)
+			}
+			if result.URI != "fake://recordings/a.wav" {
+				t.Errorf("uri = %s", result.URI)
+			}
+		})
+	}
+}
+
+func TestUploadVerifiedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	backend := &fakeBackend{}
+	result, err := UploadVerified(ctx, backend, "recordings/a.wav", "audio/wav", 4, opener("data"), 3)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if result.Attempts != 1 {
+		t.Errorf("attempts = %d, want no retry once the context is done", result.Attempts)
+	}
+}
+
+// The source changes between computing the checksum and uploading it
+func TestUploadVerifiedSourceChanged(t *testing.T) {
+	reads := 0
+	open := func() (io.ReadCloser, error) {
+		reads++
+		if reads%2 == 0 {
+			return ioutil.NopCloser(strings.NewReader("dat4")), nil
+		}
+		return ioutil.NopCloser(strings.NewReader("data")), nil
+	}
+	result, err := UploadVerified(context.Background(), &fakeBackend{}, "recordings/a.wav", "audio/wav", 4, open, 1)
+	if err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+	if reads != 2 || result.Attempts != 1 {
+		t.Errorf("reads = %d, attempts = %d", reads, result.Attempts)
+	}
+}
+
+func TestUploadVerifiedOpenError(t *testing.T) {
+	open := func() (io.ReadCloser, error) {
+		return nil, errors.New("source gone")
+	}
+	_, err := UploadVerified(context.Background(), &fakeBackend{}, "faxes/a.pdf", "application/pdf", 0, open, 1)
+	if err == nil || err.Error() != "source gone" {
+		t.Fatalf("err = %v, want the open error", err)
+	}
+}
+
+// Round trip through the local backend
+func TestUploadVerifiedLocal(t *testing.T) {
+	backend := newTestLocalBackend(t)
+	data := bytes.Repeat([]byte("fax"), 1000)
+	open := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	if _, err := UploadVerified(context.Background(), backend, "faxes/1/a.pdf", "application/pdf", int64(len(data)), open, 1); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ioutil.ReadFile(backend.dir + "/faxes/1/a.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Errorf("stored %d bytes, want %d", len(stored), len(data))
+	}
+}
@@ -1,14 +1,21 @@
 package store
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mailgun/mailgun-go/v4"
 	"github.com/sirupsen/logrus"
+	callstate "lineblocs.com/api/call"
 	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
@@ -28,30 +35,50 @@ func NewCallStore(db *sql.DB) *CallStore {
 }
 
 /*
-Input: Call model
-Todo : Create new call and store to db
+Input: Call model, concurrent call limit (nil is unlimited), age after which a call no longer counts as active
+Todo : Create new call and store to db. With a limit the workspace row is locked while its active calls are counted,
+so concurrent requests on any API instance cannot both take the last slot
 Output: First Value: callId, Second Value:error
-If success return (callid, nil) else return (nil, err)
+If success return (callid, nil), if the workspace is at its limit return ErrCapacityExceeded else return (nil, err)
 */
-func (cs *CallStore) CreateCall(call *model.Call) (string, error) {
+func (cs *CallStore) CreateCall(call *model.Call, limit *int, maxAge time.Duration) (string, error) {
 	now := time.Now()
-	call.StartedAt = now.Format("MM/DD/YYYY")
-	call.CreatedAt = now.Format("MM/DD/YYYY")
-	call.UpdatedAt = now.Format("MM/DD/YYYY")
+	call.StartedAt = now.Format(time.RFC3339)
+	call.CreatedAt = now.Format(time.RFC3339)
+	call.UpdatedAt = now.Format(time.RFC3339)
+	call.Duration = 0
 	workspace, err := cs.GetWorkspaceFromDB(call.WorkspaceId)
 
 	if err != nil {
 		return "-1", err
 	}
 
-	stmt, err := cs.db.Prepare("INSERT INTO calls ( `from`, `to`, `channel_id`, `status`, `direction`, `duration`, `sip_call_id`, `user_id`, `workspace_id`, `started_at`, `created_at`, `updated_at`, `api_id`, `plan_snapshot`, `notes`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '' )")
+	tx, err := cs.db.Begin()
 	if err != nil {
 		return "-1", err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(call.From, call.To, call.ChannelId, call.Status, call.Direction, "8", call.SIPCallId, call.UserId, call.WorkspaceId, now, now, now, call.APIId, workspace.Plan)
+	if limit != nil {
+		var locked int
+		err = tx.QueryRow("SELECT id FROM workspaces WHERE id = ? FOR UPDATE", workspace.Id).Scan(&locked)
+		if err != nil {
+			return "-1", err
+		}
+		active, err := countActiveCalls(tx, workspace.Id, maxAge)
+		if err != nil {
+			return "-1", err
+		}
+		if !utils.WithinPlanLimit(limit, active+1) {
+			return "-1", utils.ErrCapacityExceeded
+		}
+	}
 
+	res, err := tx.Exec("INSERT INTO calls ( `from`, `to`, `channel_id`, `status`, `direction`, `duration`, `sip_call_id`, `user_id`, `workspace_id`, `started_at`, `created_at`, `updated_at`, `api_id`, `plan_snapshot`, `media_server_ip`, `parent_call_id`, `leg_type`, `idempotency_key`, `notes`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '' )",
+		call.From, call.To, call.ChannelId, call.Status, call.Direction, call.Duration, call.SIPCallId, call.UserId, call.WorkspaceId, now, now, now, call.APIId, workspace.Plan, call.MediaServerIp, nullableId(call.ParentCallId), call.LegType, nullableKey(call.IdempotencyKey))
+	if isIdempotencyConflict(err, call.IdempotencyKey) {
+		return "-1", utils.ErrIdempotencyConflict
+	}
 	if err != nil {
 		return "-1", err
 	}
@@ -60,53 +87,262 @@ func (cs *CallStore) CreateCall(call *model.Call) (string, error) {
 	if err != nil {
 		return "-1", err
 	}
-	return strconv.FormatInt(callId, 10), err
+	if err := tx.Commit(); err != nil {
+		return "-1", err
+	}
+	return strconv.FormatInt(callId, 10), nil
 }
 
 /*
-Input: CallUpdate model
-Todo : Update existing call with matching id
-Output: If success return nil else return err
+Input: workspaceId, age after which a call no longer counts as active
+Todo : Count the calls of the workspace in an active status, calls whose terminal event was lost stop counting after maxAge
+Output: First Value: count, Second Value: error
+*/
+func (cs *CallStore) CountActiveCalls(workspaceId int, maxAge time.Duration) (int, error) {
+	return countActiveCalls(cs.db, workspaceId, maxAge)
+}
+
+func countActiveCalls(q queryer, workspaceId int, maxAge time.Duration) (int, error) {
+	statuses := callstate.ActiveStatuses()
+	args := make([]interface{}, 0, len(statuses)+2)
+	args = append(args, workspaceId)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, time.Now().Add(-maxAge))
+	var count int
+	row := q.QueryRow("SELECT COUNT(*) FROM calls WHERE workspace_id = ? AND status IN (?"+strings.Repeat(", ?", len(statuses)-1)+") AND started_at >= ?", args...)
+	err := row.Scan(&count)
+	return count, err
+}
+
+/*
+Input: CallUpdate model, time of the event
+Todo : Move the call with matching id through the call state machine and record the event in call_events,
+terminal events get duration and billable duration computed from the stored timestamps
+Output: If success return nil, if the transition is not legal return ErrInvalidCallTransition else return err
 */
-func (cs *CallStore) UpdateCall(update *model.CallUpdate) error {
-	// Perform a db.Query insert
-	stmt, err := cs.db.Prepare("UPDATE calls SET `status` = ?, `ended_at` = ?, `updated_at` = ? WHERE `api_id` = ?")
+func (cs *CallStore) UpdateCall(update *model.CallUpdate, at time.Time) error {
+	if !callstate.IsKnownStatus(update.Status) {
+		return fmt.Errorf("%w: %s", utils.ErrUnknownCallStatus, update.Status)
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	row := tx.QueryRow("SELECT `status` FROM calls WHERE `id` = ? FOR UPDATE", update.CallId)
+	err = row.Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	transitionErr := callstate.ValidateTransition(current.String, update.Status)
+	now := time.Now()
+	_, err = tx.Exec("INSERT INTO call_events (`call_id`, `status`, `previous_status`, `source_ip`, `hangup_cause`, `sip_status`, `accepted`, `event_at`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )",
+		update.CallId, update.Status, current.String, update.SourceIp, update.HangupCause, update.SIPStatus, transitionErr == nil, at, now, now)
+	if err != nil {
+		return err
+	}
+	if transitionErr != nil {
+		// rejected events are kept for auditing
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Rejected call %d event from %s: %s", update.CallId, update.SourceIp, transitionErr.Error()))
+		return transitionErr
+	}
+
+	var query string
+	var args []interface{}
+	switch {
+	case update.Status == callstate.StatusRinging:
+		query = "UPDATE calls SET `status` = ?, `ringing_at` = COALESCE(`ringing_at`, ?), `updated_at` = ? WHERE `id` = ?"
+		args = []interface{}{update.Status, at, now, update.CallId}
+	case update.Status == callstate.StatusAnswered:
+		query = "UPDATE calls SET `status` = ?, `answered_at` = COALESCE(`answered_at`, ?), `updated_at` = ? WHERE `id` = ?"
+		args = []interface{}{update.Status, at, now, update.CallId}
+	case callstate.IsTerminal(update.Status):
+		query = `UPDATE calls SET
+			status = ?,
+			ended_at = COALESCE(ended_at, ?),
+			duration = GREATEST(TIMESTAMPDIFF(SECOND, started_at, ended_at), 0),
+			billable_duration = IF(answered_at IS NULL, 0, GREATEST(TIMESTAMPDIFF(SECOND, answered_at, ended_at), 0)),
+			hangup_cause = NULLIF(?, ''),
+			sip_status = COALESCE(NULLIF(?, 0), sip_status),
+			updated_at = ?
+			WHERE id = ?`
+		args = []interface{}{update.Status, at, update.HangupCause, update.SIPStatus, now, update.CallId}
+	default:
+		query = "UPDATE calls SET `status` = ?, `updated_at` = ? WHERE `id` = ?"
+		args = []interface{}{update.Status, now, update.CallId}
+	}
+
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		utils.Log(logrus.InfoLevel, "UpdateCall 2 Could not execute query..")
 		utils.Log(logrus.InfoLevel, err.Error())
 		return err
 	}
-	defer stmt.Close()
-	endedAt := time.Now()
-	updatedAt := time.Now()
-	_, err = stmt.Exec(update.Status, endedAt, updatedAt, update.CallId)
+	if callstate.IsTerminal(update.Status) {
+		// commands still pending for an ended call have nothing left to act on
+		_, err = tx.Exec("UPDATE call_commands SET `status` = 'expired', `updated_at` = ? WHERE `call_id` = ? AND `status` = 'pending'", now, update.CallId)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Input: id
+Todo : Get the events reported for the call with matching id, oldest first
+Output: First Value: list of CallEvent model, Second Value: error
+*/
+func (cs *CallStore) GetCallEvents(id int) ([]*model.CallEvent, error) {
+	rows, err := cs.db.Query("SELECT `id`, `call_id`, `status`, `previous_status`, `source_ip`, `hangup_cause`, `sip_status`, `accepted`, `event_at`, `created_at` FROM call_events WHERE `call_id` = ? ORDER BY `id`", id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	events := make([]*model.CallEvent, 0)
+	for rows.Next() {
+		var event model.CallEvent
+		var eventAt, createdAt time.Time
+		err := rows.Scan(&event.Id, &event.CallId, &event.Status, &event.PreviousStatus, &event.SourceIp, &event.HangupCause, &event.SIPStatus, &event.Accepted, &eventAt, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		event.EventAt = eventAt.Format(time.RFC3339)
+		event.CreatedAt = createdAt.Format(time.RFC3339)
+		events = append(events, &event)
+	}
+	return events, rows.Err()
 }
 
 /*
-Input: Call model
-Todo : Check first call and send email
+Input: CalledCountry model
+Todo : Add the destination country to the countries the workspace has called, keeping the existing entry if there is one
+Output: First Value: stored CalledCountry model, Second Value: true on the first call to the country, Third Value: error
 */
-func (cs *CallStore) CheckIsMakingOutboundCallFirstTime(call model.Call) {
-	var id string
-	row := cs.db.QueryRow("SELECT id FROM `calls` WHERE `workspace_id` = ? AND `from` LIKE '?%s' AND `direction = 'outbound'", call.WorkspaceId, call.From, call.Direction)
-	err := row.Scan(&id)
-	if err != sql.ErrNoRows {
-		// All ok
-		return
+func (cs *CallStore) CheckIsMakingOutboundCallFirstTime(country *model.CalledCountry) (*model.CalledCountry, bool, error) {
+	now := time.Now()
+	_, err := cs.db.Exec("INSERT INTO workspace_called_countries (`workspace_id`, `country_code`, `first_number`, `high_risk`, `approved`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ? )",
+		country.WorkspaceId, country.CountryCode, country.FirstNumber, country.HighRisk, country.Approved, now, now)
+	if err == nil {
+		country.CreatedAt = now
+		return country, true, nil
 	}
-	//Send notification
-	user, err := cs.GetUserFromDB(call.UserId)
+	if !isDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	existing, err := cs.GetCalledCountry(country.WorkspaceId, country.CountryCode)
 	if err != nil {
-		panic(err)
+		return nil, false, err
 	}
-	body := `A call was made to ` + call.To + ` for the first time on your account.`
-	sendEmail(user, "First call to destination country", body)
+	return existing, false, nil
+}
+
+/*
+Input: workspaceId, countryCode
+Todo : Get a destination country of the workspace, called before or approved ahead of the first call
+Output: First Value: CalledCountry model, Second Value: error
+If not found return (nil, sql.ErrNoRows)
+*/
+func (cs *CallStore) GetCalledCountry(workspaceId int, countryCode string) (*model.CalledCountry, error) {
+	row := cs.db.QueryRow("SELECT "+calledCountryColumns+" FROM workspace_called_countries WHERE workspace_id = ? AND country_code = ?", workspaceId, countryCode)
+	return scanCalledCountry(row)
 }
 
+/*
+Input: workspaceId
+Todo : Get the destination countries the workspace has called
+Output: First Value: list of CalledCountry model, Second Value: error
+*/
+func (cs *CallStore) GetCalledCountries(workspaceId int) ([]*model.CalledCountry, error) {
+	results, err := cs.db.Query("SELECT "+calledCountryColumns+" FROM workspace_called_countries WHERE workspace_id = ? ORDER BY created_at, country_code", workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	countries := make([]*model.CalledCountry, 0)
+	for results.Next() {
+		country, err := scanCalledCountry(results)
+		if err != nil {
+			return nil, err
+		}
+		countries = append(countries, country)
+	}
+	return countries, results.Err()
+}
+
+/*
+Input: workspaceId, countryCode
+Todo : Approve calls to a destination country, countries not called yet are approved ahead of the first call
+Output: If success return nil else return err
+*/
+func (cs *CallStore) ApproveCalledCountry(workspaceId int, countryCode string) error {
+	now := time.Now()
+	_, err := cs.db.Exec("INSERT INTO workspace_called_countries (`workspace_id`, `country_code`, `first_number`, `high_risk`, `approved`, `approved_at`, `created_at`, `updated_at`) VALUES ( ?, ?, '', 0, 1, ?, ?, ? ) ON DUPLICATE KEY UPDATE `approved` = 1, `approved_at` = COALESCE(`approved_at`, VALUES(`approved_at`)), `updated_at` = VALUES(`updated_at`)",
+		workspaceId, countryCode, now, now, now)
+	return err
+}
+
+const calledCountryColumns = "`workspace_id`, `country_code`, `first_number`, `high_risk`, `approved`, `created_at`, `approved_at`"
+
+func scanCalledCountry(row rowScanner) (*model.CalledCountry, error) {
+	country := model.CalledCountry{}
+	var approvedAt sql.NullTime
+	err := row.Scan(&country.WorkspaceId, &country.CountryCode, &country.FirstNumber, &country.HighRisk, &country.Approved, &country.CreatedAt, &approvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if approvedAt.Valid {
+		country.ApprovedAt = &approvedAt.Time
+	}
+	return &country, nil
+}
+
+/*
+Input: Workspace model, CalledCountry model
+Todo : Email the workspace owner that a destination country was called for the first time
+Output: If success return nil else return err
+*/
+func (cs *CallStore) SendNewDestinationEmail(workspace *model.Workspace, country *model.CalledCountry) error {
+	user, err := cs.GetUserFromDB(workspace.CreatorId)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	err = newDestinationEmailTemplate.Execute(&body, map[string]interface{}{
+		"User":      user,
+		"Workspace": workspace,
+		"Country":   country})
+	if err != nil {
+		return err
+	}
+	return sendEmail(user, "First call to destination country +"+country.CountryCode, body.String())
+}
+
+var newDestinationEmailTemplate = template.Must(template.New("new_destination").Parse(`<html>
+<head></head>
+<body>
+	<h1>New destination country</h1>
+	<p>Hi {{.User.FirstName}},</p>
+	<p>A call to {{.Country.FirstNumber}} was made from your workspace {{.Workspace.Name}}. This is the first call to country code +{{.Country.CountryCode}} on your account.</p>
+	{{if .Country.HighRisk}}<p>This destination is marked as high risk.</p>{{end}}
+	{{if not .Country.Approved}}<p>The call was refused. Approve the destination country to allow calls to it.</p>{{end}}
+	<p>If you did not expect this call, please review your account activity.</p>
+</body>
+</html>`))
+
 /*
 Input: id
 Todo : Fetch a call with call_id
@@ -114,9 +350,21 @@ Output: First Value: Call model,Second Value: error
 If success return Call model else return err
 */
 func (cs *CallStore) GetCallFromDB(id int) (*model.Call, error) {
-	row := cs.db.QueryRow("SELECT `from`, `to`, `channel_id`, `status`, `direction`, `duration`, `user_id`, `workspace_id`, `started_at`, `created_at`, `updated_at`, `api_id`, `plan_snapshot`) FROM calls WHERE id = ?", id)
+	row := cs.db.QueryRow("SELECT "+callColumns+" FROM calls WHERE id = ?", id)
+	return scanCall(row)
+}
+
+const callColumns = "`id`, `from`, `to`, `channel_id`, `status`, `direction`, `duration`, `user_id`, `workspace_id`, `started_at`, `created_at`, `updated_at`, `api_id`, `plan_snapshot`, `provider_id`, `media_server_ip`, `parent_call_id`, `leg_type`, `ringing_at`, `answered_at`, `ended_at`, `billable_duration`, `hangup_cause`, `sip_status`"
+
+// Extra destinations are scanned from columns selected after callColumns
+func scanCall(row rowScanner, extra ...interface{}) (*model.Call, error) {
 	call := model.Call{}
-	err := row.Scan(
+	var startedAt, createdAt, updatedAt time.Time
+	var ringingAt, answeredAt, endedAt sql.NullTime
+	var providerId, parentCallId, billableDuration, sipStatus sql.NullInt64
+	var hangupCause, mediaServerIp, legType sql.NullString
+	dest := []interface{}{
+		&call.Id,
 		&call.From,
 		&call.To,
 		&call.ChannelId,
@@ -125,17 +373,444 @@ func (cs *CallStore) GetCallFromDB(id int) (*model.Call, error) {
 		&call.Duration,
 		&call.UserId,
 		&call.WorkspaceId,
-		&call.StartedAt,
-		&call.CreatedAt,
-		&call.UpdatedAt,
+		&startedAt,
+		&createdAt,
+		&updatedAt,
 		&call.APIId,
-		&call.PlanSnapshot)
-	if err == sql.ErrNoRows {
+		&call.PlanSnapshot,
+		&providerId,
+		&mediaServerIp,
+		&parentCallId,
+		&legType,
+		&ringingAt,
+		&answeredAt,
+		&endedAt,
+		&billableDuration,
+		&hangupCause,
+		&sipStatus}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
 		return nil, err
 	}
+	call.StartedAt = startedAt.Format(time.RFC3339)
+	call.CreatedAt = createdAt.Format(time.RFC3339)
+	call.UpdatedAt = updatedAt.Format(time.RFC3339)
+	call.ProviderId = int(providerId.Int64)
+	call.MediaServerIp = mediaServerIp.String
+	call.ParentCallId = int(parentCallId.Int64)
+	call.LegType = legType.String
+	if call.LegType == "" {
+		call.LegType = model.LegTypeOriginal
+	}
+	call.RingingAt = formatNullTime(ringingAt)
+	call.AnsweredAt = formatNullTime(answeredAt)
+	call.EndedAt = formatNullTime(endedAt)
+	call.BillableDuration = int(billableDuration.Int64)
+	call.HangupCause = hangupCause.String
+	call.SIPStatus = int(sipStatus.Int64)
 	return &call, nil
 }
 
+// Columns calls can be sorted by, the id breaks ties so the order is stable for keyset pagination
+var callSortColumns = map[string]string{
+	"started_at": "started_at",
+	"duration":   "duration",
+}
+
+type callCursor struct {
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+/*
+Input: CallFilter model
+Todo : List the calls matching the filter one page at a time, pages continue from the keyset cursor of the previous page
+Output: First Value: CallList model with the total matching calls and the cursor of the next page, Second Value: error
+*/
+func (cs *CallStore) ListCalls(filter *model.CallFilter) (*model.CallList, error) {
+	sortColumn, ok := callSortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("cannot sort calls by %q", filter.SortBy)
+	}
+
+	where, args := buildCallFilter(filter)
+	list := &model.CallList{Calls: make([]*model.Call, 0)}
+	row := cs.db.QueryRow("SELECT COUNT(*) FROM calls WHERE "+strings.Join(where, " AND "), args...)
+	if err := row.Scan(&list.Total); err != nil {
+		return nil, err
+	}
+
+	comparison, order := ">", "ASC"
+	if filter.Descending {
+		comparison, order = "<", "DESC"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCallCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{} = cursor.Value
+		if sortColumn == "started_at" {
+			value, err = time.Parse(time.RFC3339, cursor.Value)
+			if err != nil {
+				return nil, utils.ErrInvalidCursor
+			}
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortColumn, comparison))
+		args = append(args, value, value, cursor.Id)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM calls WHERE %s ORDER BY %s %s, id %s LIMIT ?", callColumns, strings.Join(where, " AND "), sortColumn, order, order)
+	rows, err := cs.db.Query(query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		call, err := scanCall(rows)
+		if err != nil {
+			return nil, err
+		}
+		list.Calls = append(list.Calls, call)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// one extra row is read to know whether there is a next page
+	if len(list.Calls) > filter.Limit {
+		list.Calls = list.Calls[:filter.Limit]
+		last := list.Calls[len(list.Calls)-1]
+		value := last.StartedAt
+		if sortColumn == "duration" {
+			value = strconv.Itoa(last.Duration)
+		}
+		list.NextCursor = encodeCallCursor(callCursor{Value: value, Id: last.Id})
+	}
+	return list, nil
+}
+
+func buildCallFilter(filter *model.CallFilter) ([]string, []interface{}) {
+	where := []string{"workspace_id = ?"}
+	args := []interface{}{filter.WorkspaceId}
+	if filter.Direction != "" {
+		where = append(where, "direction = ?")
+		args = append(args, filter.Direction)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.FromPrefix != "" {
+		where = append(where, "`from` LIKE ?")
+		args = append(args, escapeLike(filter.FromPrefix)+"%")
+	}
+	if filter.ToPrefix != "" {
+		where = append(where, "`to` LIKE ?")
+		args = append(args, escapeLike(filter.ToPrefix)+"%")
+	}
+	if filter.StartedFrom != nil {
+		where = append(where, "started_at >= ?")
+		args = append(args, *filter.StartedFrom)
+	}
+	if filter.StartedTo != nil {
+		where = append(where, "started_at < ?")
+		args = append(args, *filter.StartedTo)
+	}
+	if filter.ProviderId != 0 {
+		where = append(where, "provider_id = ?")
+		args = append(args, filter.ProviderId)
+	}
+	if filter.SIPStatus != 0 {
+		where = append(where, "sip_status = ?")
+		args = append(args, filter.SIPStatus)
+	}
+	return where, args
+}
+
+/*
+Input: CallFilter model, callback
+Todo : Stream the calls matching the filter ordered by start time with the cents debited for each call,
+rows are handed to the callback one at a time so an export never holds the result set in memory
+Output: If success return nil else return the query or callback err
+*/
+func (cs *CallStore) ExportCalls(filter *model.CallFilter, fn func(*model.Call, float64) error) error {
+	where, args := buildCallFilter(filter)
+	query := fmt.Sprintf(`SELECT %s,
+		(SELECT COALESCE(SUM(users_debits.cents), 0) FROM users_debits WHERE users_debits.call_id = calls.id)
+		FROM calls WHERE %s ORDER BY started_at, id`, callColumns, strings.Join(where, " AND "))
+	rows, err := cs.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cents float64
+		call, err := scanCall(rows, &cents)
+		if err != nil {
+			return err
+		}
+		if err := fn(call, cents); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+/*
+Input: LiveCallFilter model, max age of a live call
+Todo : List the calls that have not reached a terminal status, calls older than the max age are left out as stale
+Output: First Value: list of LiveCall model with elapsed time and pending hangups, Second Value: error
+*/
+func (cs *CallStore) ListLiveCalls(filter *model.LiveCallFilter, maxAge time.Duration) ([]*model.LiveCall, error) {
+	statuses := callstate.ActiveStatuses()
+	where := []string{"status IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")", "started_at >= ?"}
+	args := make([]interface{}, 0, len(statuses)+4)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, time.Now().Add(-maxAge))
+	if filter.WorkspaceId != 0 {
+		where = append(where, "workspace_id = ?")
+		args = append(args, filter.WorkspaceId)
+	}
+	if filter.MediaServerIp != "" {
+		where = append(where, "media_server_ip = ?")
+		args = append(args, filter.MediaServerIp)
+	}
+	if filter.ProviderId != 0 {
+		where = append(where, "provider_id = ?")
+		args = append(args, filter.ProviderId)
+	}
+
+	query := fmt.Sprintf(`SELECT %s,
+		EXISTS (SELECT 1 FROM call_commands WHERE call_commands.call_id = calls.id AND call_commands.status = 'pending')
+		FROM calls WHERE %s ORDER BY started_at`, callColumns, strings.Join(where, " AND "))
+	rows, err := cs.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	calls := make([]*model.LiveCall, 0)
+	for rows.Next() {
+		var hangupPending bool
+		call, err := scanCall(rows, &hangupPending)
+		if err != nil {
+			return nil, err
+		}
+		live := &model.LiveCall{Call: call, HangupPending: hangupPending}
+		if startedAt, err := time.Parse(time.RFC3339, call.StartedAt); err == nil {
+			live.ElapsedSeconds = int(now.Sub(startedAt).Seconds())
+		}
+		calls = append(calls, live)
+	}
+	return calls, rows.Err()
+}
+
+/*
+Input: CallCommand model
+Todo : Queue a command for the media server handling the call, a command already pending for the call is returned instead of queueing it twice
+Output: First Value: CallCommand model, Second Value: error
+*/
+func (cs *CallStore) CreateCallCommand(command *model.CallCommand) (*model.CallCommand, error) {
+	existing, err := scanCallCommand(cs.db.QueryRow("SELECT "+callCommandColumns+" FROM call_commands INNER JOIN calls ON calls.id = call_commands.call_id WHERE call_commands.call_id = ? AND call_commands.command = ? AND call_commands.status = 'pending'", command.CallId, command.Command))
+	if err == nil {
+		return existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	now := time.Now()
+	stmt, err := cs.db.Prepare("INSERT INTO call_commands (`call_id`, `workspace_id`, `media_server_ip`, `command`, `reason`, `requested_by`, `status`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, 'pending', ?, ? )")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(command.CallId, command.WorkspaceId, command.MediaServerIp, command.Command, command.Reason, command.RequestedBy, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	command.Id = int(id)
+	command.Status = "pending"
+	command.CreatedAt = now.Format(time.RFC3339)
+	return command, nil
+}
+
+/*
+Input: media server ip
+Todo : Get the commands pending for calls handled by the media server, oldest first
+Output: First Value: list of CallCommand model, Second Value: error
+*/
+func (cs *CallStore) GetPendingCallCommands(mediaServerIp string) ([]*model.CallCommand, error) {
+	rows, err := cs.db.Query("SELECT "+callCommandColumns+" FROM call_commands INNER JOIN calls ON calls.id = call_commands.call_id WHERE call_commands.media_server_ip = ? AND call_commands.status = 'pending' ORDER BY call_commands.id", mediaServerIp)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := make([]*model.CallCommand, 0)
+	for rows.Next() {
+		command, err := scanCallCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, rows.Err()
+}
+
+/*
+Input: command id, media server ip
+Todo : Mark a pending command as acknowledged by the media server that picked it up
+Output: First Value: true if a pending command was acknowledged, Second Value: error
+*/
+func (cs *CallStore) AcknowledgeCallCommand(id int, mediaServerIp string) (bool, error) {
+	now := time.Now()
+	res, err := cs.db.Exec("UPDATE call_commands SET `status` = 'acknowledged', `acknowledged_at` = ?, `updated_at` = ? WHERE `id` = ? AND `media_server_ip` = ? AND `status` = 'pending'", now, now, id, mediaServerIp)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+const callCommandColumns = "call_commands.id, call_commands.call_id, calls.api_id, call_commands.workspace_id, call_commands.media_server_ip, call_commands.command, call_commands.reason, call_commands.requested_by, call_commands.status, call_commands.created_at, call_commands.acknowledged_at"
+
+func scanCallCommand(row rowScanner) (*model.CallCommand, error) {
+	var command model.CallCommand
+	var createdAt time.Time
+	var acknowledgedAt sql.NullTime
+	err := row.Scan(&command.Id, &command.CallId, &command.CallAPIId, &command.WorkspaceId, &command.MediaServerIp, &command.Command, &command.Reason, &command.RequestedBy, &command.Status, &createdAt, &acknowledgedAt)
+	if err != nil {
+		return nil, err
+	}
+	command.CreatedAt = createdAt.Format(time.RFC3339)
+	command.AcknowledgedAt = formatNullTime(acknowledgedAt)
+	return &command, nil
+}
+
+// Deepest chain of legs followed, guards against parent links that loop
+const maxCallLegDepth = 32
+
+/*
+Input: id of any leg of a call
+Todo : Get the whole tree of legs the call belongs to, starting from the original leg, with the cents debited for each leg
+Output: First Value: CallLegTree model with the combined duration and cost, Second Value: error
+*/
+func (cs *CallStore) GetCallLegTree(id int) (*model.CallLegTree, error) {
+	rootId := id
+	for depth := 0; ; depth++ {
+		call, err := cs.GetCallFromDB(rootId)
+		if err != nil {
+			return nil, err
+		}
+		if call.ParentCallId == 0 || depth == maxCallLegDepth {
+			break
+		}
+		rootId = call.ParentCallId
+	}
+
+	root, err := cs.getCallLegs("id = ?", rootId)
+	if err != nil {
+		return nil, err
+	}
+	if len(root) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	tree := &model.CallLegTree{Root: root[0]}
+	seen := map[int]bool{}
+	level := root
+	for depth := 0; len(level) > 0 && depth <= maxCallLegDepth; depth++ {
+		parents := make(map[int]*model.CallLeg, len(level))
+		args := make([]interface{}, 0, len(level))
+		for _, leg := range level {
+			if seen[leg.Id] {
+				continue
+			}
+			seen[leg.Id] = true
+			tree.LegCount++
+			tree.TotalDuration += leg.Duration
+			tree.TotalBillableDuration += leg.BillableDuration
+			tree.TotalCostCents += leg.CostCents
+			parents[leg.Id] = leg
+			args = append(args, leg.Id)
+		}
+		if len(args) == 0 {
+			break
+		}
+		children, err := cs.getCallLegs("parent_call_id IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			parent := parents[child.ParentCallId]
+			parent.Legs = append(parent.Legs, child)
+		}
+		level = children
+	}
+	return tree, nil
+}
+
+func (cs *CallStore) getCallLegs(where string, args ...interface{}) ([]*model.CallLeg, error) {
+	rows, err := cs.db.Query(fmt.Sprintf(`SELECT %s,
+		(SELECT COALESCE(SUM(users_debits.cents), 0) FROM users_debits WHERE users_debits.call_id = calls.id)
+		FROM calls WHERE %s ORDER BY started_at, id`, callColumns, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	legs := make([]*model.CallLeg, 0)
+	for rows.Next() {
+		leg := &model.CallLeg{Legs: make([]*model.CallLeg, 0)}
+		leg.Call, err = scanCall(rows, &leg.CostCents)
+		if err != nil {
+			return nil, err
+		}
+		legs = append(legs, leg)
+	}
+	return legs, rows.Err()
+}
+
+func encodeCallCursor(cursor callCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCallCursor(value string) (*callCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	var cursor callCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+func formatNullTime(value sql.NullTime) *string {
+	if !value.Valid {
+		return nil
+	}
+	formatted := value.Time.Format(time.RFC3339)
+	return &formatted
+}
+
 /*
 Input: callid, apiid
 Todo : Set sip_call_id field with matching id
@@ -184,40 +859,24 @@ func (cs *CallStore) SetProviderByIP(ip string, apiid string) error {
 }
 
 /*
-Input: Conference model
-Todo : Create new conference and store to db
-Output: First Value: ConferenceId, Second Value: error
-If success return (conferenceId, nil) else return (-1, err)
+Input: User model, subject, html body
+Todo : Send a notification email to the user through Mailgun
+Output: If success return nil else return err
 */
-func (cs *CallStore) CreateConference(conference *model.Conference) (string, error) {
-	var id int
-	var name string
-	row := cs.db.QueryRow("SELECT id, name FROM conferences WHERE workspace_id=? AND name=?", conference.WorkspaceId, conference.Name)
-	err := row.Scan(&id, &name)
-	if err == sql.ErrNoRows {
-		conference.APIId = utils.CreateAPIID("conf")
-		// perform a db.Query insert
-		now := time.Now()
-		stmt, err := cs.db.Prepare("INSERT INTO conferences (`name`, `workspace_id`, `api_id`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ? )")
-		if err != nil {
-			return "-1", err
-		}
-		defer stmt.Close()
-		res, err := stmt.Exec(conference.Name, conference.WorkspaceId, conference.APIId, now, now)
+func sendEmail(user *model.User, subject string, body string) error {
+	mg := mailgun.NewMailgun(utils.Config("MAILGUN_DOMAIN"), utils.Config("MAILGUN_API_KEY"))
+	m := mg.NewMessage(
+		"Lineblocs <monitor@lineblocs.com>",
+		subject,
+		subject,
+		user.Email)
+	m.SetHtml(body)
 
-		if err != nil {
-			return "-1", err
-		}
-		conferenceId, err := res.LastInsertId()
-		if err != nil {
-			return "-1", err
-		}
-		return strconv.FormatInt(conferenceId, 10), nil
-	}
-	return strconv.Itoa(id), nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 
-func sendEmail(user *model.User, subject string, body string) {
+	_, _, err := mg.Send(ctx, m)
+	return err
 }
 
 /*
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"lineblocs.com/api/utils"
+)
+
+func TestCallCursor(t *testing.T) {
+	cursor := callCursor{Value: "2026-10-01T10:00:00Z", Id: 42}
+	decoded, err := decodeCallCursor(encodeCallCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeCallCursor: %v", err)
+	}
+	if *decoded != cursor {
+		t.Errorf("cursor = %+v, want %+v", *decoded, cursor)
+	}
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeCallCursor(value); !errors.Is(err, utils.ErrInvalidCursor) {
+			t.Errorf("decodeCallCursor(%q) err = %v, want ErrInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"+1416":  "+1416",
+		"100%":   "100\\%",
+		"a_b":    "a\\_b",
+		"back\\": "back\\\\",
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
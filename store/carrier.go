@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"strconv"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"lineblocs.com/api/helpers"
+	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
 
@@ -26,27 +29,192 @@ func NewCarrierStore(db *sql.DB) *CarrierStore {
 }
 
 /*
-Input: callid, status
-Todo : Update sip_status of calls with matching sip_call_id
+Input: SIPReport model
+Todo : Update sip_status of calls with matching sip_call_id and record the attempt for carrier statistics.
+A call is one attempt, so only final responses are recorded and a later final response replaces the earlier one
 Output: If success return nil else return err
 */
-func (crs *CarrierStore) CreateSIPReport(callid string, status string) error {
+func (crs *CarrierStore) CreateSIPReport(report *model.SIPReport) error {
 	stmt, err := crs.db.Prepare("UPDATE `calls` SET sip_status = ? WHERE sip_call_id = ?")
 	if err != nil {
 		utils.Log(logrus.ErrorLevel, "CreateSIPReport 2 Could not execute query..")
 		return err
 	}
 	defer stmt.Close()
+	_, err = stmt.Exec(report.Status, report.SIPCallId)
+	if err != nil {
+		return err
+	}
 
-	statusAsInt, err := strconv.Atoi(status)
+	if !utils.IsSIPFinal(report.Status) {
+		return nil
+	}
+
+	var callId int
+	var providerId sql.NullInt64
+	var to string
+	row := crs.db.QueryRow("SELECT `id`, `provider_id`, `to` FROM calls WHERE sip_call_id = ?", report.SIPCallId)
+	err = row.Scan(&callId, &providerId, &to)
+	if err == sql.ErrNoRows {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("CreateSIPReport no call with SIP call ID %s, not counted in carrier stats", report.SIPCallId))
+		return nil
+	}
 	if err != nil {
-		utils.Log(logrus.ErrorLevel, "CreateSIPReport 3 error in convert...")
 		return err
 	}
-	_, err = stmt.Exec(statusAsInt, callid)
+
+	// attribute the attempt to the prefix the provider rated the destination with
+	dialPrefix := ""
+	if providerId.Valid {
+		rates, err := queryActiveProviderRates(crs.db, to, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, value := range rates {
+			if value.rate.ProviderId == int(providerId.Int64) && len(value.rate.DialPrefix) > len(dialPrefix) {
+				dialPrefix = value.rate.DialPrefix
+			}
+		}
+	}
+
+	now := time.Now()
+	_, err = crs.db.Exec("INSERT INTO carrier_sip_reports (`call_id`, `provider_id`, `dial_prefix`, `sip_status`, `pdd_ms`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ? ) "+
+		"ON DUPLICATE KEY UPDATE `sip_status` = VALUES(`sip_status`), `pdd_ms` = COALESCE(VALUES(`pdd_ms`), `pdd_ms`), `updated_at` = VALUES(`updated_at`)",
+		callId, providerId, dialPrefix, report.Status, report.PDDMs, now, now)
 	return err
 }
 
+/*
+Input: CarrierStatsFilter model
+Todo : Compute answer-seizure ratio, average call duration, post dial delay and failure codes of the SIP reports in the period,
+per provider and optionally per dial prefix and hourly or daily window
+Output: First Value: list of CarrierStats model, Second Value: error
+*/
+func (crs *CarrierStore) GetCarrierStats(filter *model.CarrierStatsFilter) ([]*model.CarrierStats, error) {
+	prefixColumn := "''"
+	if filter.ByPrefix {
+		prefixColumn = "carrier_sip_reports.dial_prefix"
+	}
+	var windowColumn string
+	switch filter.Interval {
+	case "":
+		windowColumn = "''"
+	case "hour":
+		windowColumn = "DATE_FORMAT(carrier_sip_reports.created_at, '%Y-%m-%d %H:00:00')"
+	case "day":
+		windowColumn = "DATE_FORMAT(carrier_sip_reports.created_at, '%Y-%m-%d')"
+	default:
+		return nil, fmt.Errorf("unknown stats interval %q", filter.Interval)
+	}
+
+	where := []string{"carrier_sip_reports.provider_id IS NOT NULL", "carrier_sip_reports.created_at >= ?", "carrier_sip_reports.created_at < ?"}
+	args := []interface{}{filter.Start, filter.End}
+	if filter.ProviderId != 0 {
+		where = append(where, "carrier_sip_reports.provider_id = ?")
+		args = append(args, filter.ProviderId)
+	}
+	if filter.DialPrefix != "" {
+		where = append(where, "carrier_sip_reports.dial_prefix LIKE ?")
+		args = append(args, escapeLike(filter.DialPrefix)+"%")
+	}
+
+	rows, err := crs.db.Query(`SELECT carrier_sip_reports.provider_id, `+prefixColumn+`, `+windowColumn+`,
+		carrier_sip_reports.sip_status,
+		COUNT(*),
+		COALESCE(SUM(calls.billable_duration), 0),
+		COALESCE(SUM(carrier_sip_reports.pdd_ms), 0),
+		COUNT(carrier_sip_reports.pdd_ms)
+		FROM carrier_sip_reports
+		INNER JOIN calls ON calls.id = carrier_sip_reports.call_id
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1, 2, 3`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type statsKey struct {
+		providerId int
+		dialPrefix string
+		window     string
+	}
+	type statsTotals struct {
+		billableSeconds float64
+		pddMs           float64
+		pddCount        int
+	}
+	stats := make([]*model.CarrierStats, 0)
+	byKey := make(map[statsKey]*model.CarrierStats)
+	totals := make(map[statsKey]*statsTotals)
+	for rows.Next() {
+		var key statsKey
+		var sipStatus, attempts, pddCount int
+		var billableSeconds, pddMs float64
+		err := rows.Scan(&key.providerId, &key.dialPrefix, &key.window, &sipStatus, &attempts, &billableSeconds, &pddMs, &pddCount)
+		if err != nil {
+			return nil, err
+		}
+		stat, ok := byKey[key]
+		if !ok {
+			stat = &model.CarrierStats{ProviderId: key.providerId, DialPrefix: key.dialPrefix, WindowStart: key.window, FailureCodes: make(map[int]int)}
+			byKey[key] = stat
+			totals[key] = &statsTotals{}
+			stats = append(stats, stat)
+		}
+		stat.Attempts += attempts
+		if utils.IsSIPSuccess(sipStatus) {
+			stat.Answered += attempts
+			totals[key].billableSeconds += billableSeconds
+		} else {
+			stat.FailureCodes[sipStatus] += attempts
+		}
+		totals[key].pddMs += pddMs
+		totals[key].pddCount += pddCount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for key, stat := range byKey {
+		stat.ASR = utils.CalculateASR(stat.Answered, stat.Attempts)
+		if stat.Answered > 0 {
+			stat.ACD = totals[key].billableSeconds / float64(stat.Answered)
+		}
+		if totals[key].pddCount > 0 {
+			stat.AvgPDDMs = totals[key].pddMs / float64(totals[key].pddCount)
+		}
+	}
+	return stats, nil
+}
+
+/*
+Input: db, since, minimum attempts
+Todo : Get the answer-seizure ratio of every provider with enough attempts since the given time
+Output: First Value: map of provider id to ASR in percent, Second Value: error
+*/
+func queryProviderASR(db *sql.DB, since time.Time, minAttempts int) (map[int]float64, error) {
+	rows, err := db.Query(`SELECT provider_id, COUNT(*), SUM(sip_status BETWEEN 200 AND 299)
+		FROM carrier_sip_reports
+		WHERE provider_id IS NOT NULL AND created_at >= ?
+		GROUP BY provider_id
+		HAVING COUNT(*) >= ?`, since, minAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	asr := make(map[int]float64)
+	for rows.Next() {
+		var providerId, attempts, answered int
+		if err := rows.Scan(&providerId, &attempts, &answered); err != nil {
+			return nil, err
+		}
+		asr[providerId] = utils.CalculateASR(answered, attempts)
+	}
+	return asr, rows.Err()
+}
+
 /*
 Input: originCode, destCode, userid
 Todo : Create and Start Router Flow
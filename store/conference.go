@@ -0,0 +1,428 @@
+package store
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Implementation of Conference Store
+*/
+
+type ConferenceStore struct {
+	db *sql.DB
+}
+
+func NewConferenceStore(db *sql.DB) *ConferenceStore {
+	return &ConferenceStore{
+		db: db,
+	}
+}
+
+/*
+Input: Conference model with hashed PINs
+Todo : Get the conference of the workspace with the same name or create it with the given settings.
+An existing conference keeps its settings and is copied into the model, settings sent for it are refused
+so a caller asking for a protected conference never gets an unprotected one
+Output: First Value: ConferenceId, Second Value: error
+If success return (conferenceId, nil), if settings are sent for an existing conference return (-1, ErrConferenceExists) else return (-1, err)
+*/
+func (cfs *ConferenceStore) CreateConference(conference *model.Conference) (string, error) {
+	existing, err := scanConference(cfs.db.QueryRow("SELECT "+conferenceColumns+" FROM conferences WHERE workspace_id=? AND name=?", conference.WorkspaceId, conference.Name))
+	if err == nil {
+		if hasConferenceSettings(conference) {
+			return "-1", utils.ErrConferenceExists
+		}
+		*conference = *existing
+		return strconv.Itoa(conference.Id), nil
+	}
+	if err != sql.ErrNoRows {
+		return "-1", err
+	}
+
+	conference.APIId = utils.CreateAPIID("conf")
+	now := time.Now()
+	stmt, err := cfs.db.Prepare("INSERT INTO conferences (`name`, `workspace_id`, `api_id`, `max_participants`, `starts_at`, `ends_at`, `moderator_pin_hash`, `attendee_pin_hash`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )")
+	if err != nil {
+		return "-1", err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(conference.Name, conference.WorkspaceId, conference.APIId, conference.MaxParticipants, conference.StartsAt, conference.EndsAt,
+		nullableKey(conference.ModeratorPinHash), nullableKey(conference.AttendeePinHash), now, now)
+	if err != nil {
+		return "-1", err
+	}
+	conferenceId, err := res.LastInsertId()
+	if err != nil {
+		return "-1", err
+	}
+	conference.Id = int(conferenceId)
+	return strconv.FormatInt(conferenceId, 10), nil
+}
+
+func hasConferenceSettings(conference *model.Conference) bool {
+	return conference.MaxParticipants != nil || conference.StartsAt != nil || conference.EndsAt != nil ||
+		conference.ModeratorPinHash != "" || conference.AttendeePinHash != ""
+}
+
+const conferenceColumns = "`id`, `name`, `workspace_id`, `api_id`, `max_participants`, `starts_at`, `ends_at`, `moderator_pin_hash`, `attendee_pin_hash`"
+
+func scanConference(row rowScanner) (*model.Conference, error) {
+	conference := model.Conference{}
+	var maxParticipants sql.NullInt64
+	var startsAt, endsAt sql.NullTime
+	var moderatorPinHash, attendeePinHash sql.NullString
+	err := row.Scan(&conference.Id, &conference.Name, &conference.WorkspaceId, &conference.APIId,
+		&maxParticipants, &startsAt, &endsAt, &moderatorPinHash, &attendeePinHash)
+	if err != nil {
+		return nil, err
+	}
+	conference.MaxParticipants = nullableLimit(maxParticipants)
+	if startsAt.Valid {
+		conference.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		conference.EndsAt = &endsAt.Time
+	}
+	conference.ModeratorPinHash = moderatorPinHash.String
+	conference.AttendeePinHash = attendeePinHash.String
+	conference.HasModeratorPin = conference.ModeratorPinHash != ""
+	conference.HasAttendeePin = conference.AttendeePinHash != ""
+	return &conference, nil
+}
+
+/*
+Input: Conference model with hashed PINs
+Todo : Update the participant cap, schedule window and PIN hashes of a conference
+Output: If success return nil, if the conference is not found return sql.ErrNoRows else return err
+*/
+func (cfs *ConferenceStore) UpdateConferenceSettings(conference *model.Conference) error {
+	res, err := cfs.db.Exec("UPDATE conferences SET `max_participants` = ?, `starts_at` = ?, `ends_at` = ?, `moderator_pin_hash` = ?, `attendee_pin_hash` = ?, `updated_at` = ? WHERE `id` = ?",
+		conference.MaxParticipants, conference.StartsAt, conference.EndsAt,
+		nullableKey(conference.ModeratorPinHash), nullableKey(conference.AttendeePinHash), time.Now(), conference.Id)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+/*
+Input: conference id
+Todo : Count the participants currently in the conference
+Output: First Value: participant count, Second Value: error
+*/
+func (cfs *ConferenceStore) CountLiveParticipants(conferenceId int) (int, error) {
+	var count int
+	row := cfs.db.QueryRow("SELECT COUNT(*) FROM conference_participants WHERE conference_id = ? AND left_at IS NULL", conferenceId)
+	err := row.Scan(&count)
+	return count, err
+}
+
+/*
+Input: conference api id
+Todo : Get a conference
+Output: First Value: Conference model, Second Value: error, sql.ErrNoRows when not found
+*/
+func (cfs *ConferenceStore) GetConference(apiId string) (*model.Conference, error) {
+	row := cfs.db.QueryRow("SELECT "+conferenceColumns+" FROM conferences WHERE api_id = ?", apiId)
+	return scanConference(row)
+}
+
+/*
+Input: conference api id, call api id, role, participant limit (nil is unlimited), join time
+Todo : Add the call to the conference, starting a new session when nobody is in the conference yet
+Output: First Value: ConferenceParticipant model, Second Value: error
+sql.ErrNoRows when the conference or call is not found, utils.ErrAlreadyInConference when the call already joined,
+utils.ErrConferenceFull when the limit is reached
+*/
+func (cfs *ConferenceStore) JoinConference(conferenceAPIId string, callAPIId string, role string, limit *int, at time.Time) (*model.ConferenceParticipant, error) {
+	tx, err := cfs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the conference row lock serializes session changes
+	conference, err := scanConference(tx.QueryRow("SELECT "+conferenceColumns+" FROM conferences WHERE api_id = ? FOR UPDATE", conferenceAPIId))
+	if err != nil {
+		return nil, err
+	}
+	participant := &model.ConferenceParticipant{ConferenceId: conference.Id, CallAPIId: callAPIId, Role: role, JoinedAt: at}
+	var callWorkspaceId int
+	row := tx.QueryRow("SELECT id, workspace_id FROM calls WHERE api_id = ?", callAPIId)
+	if err = row.Scan(&participant.CallId, &callWorkspaceId); err != nil {
+		return nil, err
+	}
+	if callWorkspaceId != conference.WorkspaceId {
+		return nil, utils.ErrConferenceWorkspace
+	}
+
+	row = tx.QueryRow("SELECT id FROM conference_sessions WHERE conference_id = ? AND ended_at IS NULL", conference.Id)
+	err = row.Scan(&participant.SessionId)
+	if err == sql.ErrNoRows {
+		res, err := tx.Exec("INSERT INTO conference_sessions (`conference_id`, `workspace_id`, `started_at`, `duration`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, 0, ?, ? )",
+			conference.Id, conference.WorkspaceId, at, at, at)
+		if err != nil {
+			return nil, err
+		}
+		sessionId, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		participant.SessionId = int(sessionId)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var existing int
+	row = tx.QueryRow("SELECT id FROM conference_participants WHERE session_id = ? AND call_id = ? AND left_at IS NULL", participant.SessionId, participant.CallId)
+	err = row.Scan(&existing)
+	if err == nil {
+		return nil, utils.ErrAlreadyInConference
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var participants int
+	row = tx.QueryRow("SELECT COUNT(*) FROM conference_participants WHERE session_id = ? AND left_at IS NULL", participant.SessionId)
+	if err = row.Scan(&participants); err != nil {
+		return nil, err
+	}
+	if !utils.WithinPlanLimit(limit, participants+1) {
+		return nil, utils.ErrConferenceFull
+	}
+
+	res, err := tx.Exec("INSERT INTO conference_participants (`session_id`, `conference_id`, `call_id`, `role`, `joined_at`, `duration`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, 0, ?, ? )",
+		participant.SessionId, participant.ConferenceId, participant.CallId, participant.Role, at, at, at)
+	if err != nil {
+		return nil, err
+	}
+	participantId, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	participant.Id = int(participantId)
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return participant, nil
+}
+
+const participantColumns = `conference_participants.id, conference_participants.session_id, conference_participants.conference_id,
+	conference_participants.call_id, calls.api_id, conference_participants.role, conference_participants.joined_at,
+	conference_participants.left_at, conference_participants.duration`
+
+const participantJoins = `FROM conference_participants
+	INNER JOIN calls ON calls.id = conference_participants.call_id
+	INNER JOIN conferences ON conferences.id = conference_participants.conference_id`
+
+func scanParticipant(row rowScanner) (*model.ConferenceParticipant, error) {
+	participant := model.ConferenceParticipant{}
+	var leftAt sql.NullTime
+	err := row.Scan(&participant.Id, &participant.SessionId, &participant.ConferenceId, &participant.CallId, &participant.CallAPIId,
+		&participant.Role, &participant.JoinedAt, &leftAt, &participant.Duration)
+	if err != nil {
+		return nil, err
+	}
+	if leftAt.Valid {
+		participant.LeftAt = &leftAt.Time
+	}
+	return &participant, nil
+}
+
+/*
+Input: conference api id, call api id, leave time
+Todo : Remove the call from the conference and end the session when it was the last participant
+Output: First Value: ConferenceParticipant model, Second Value: error, sql.ErrNoRows when the call is not in the conference
+*/
+func (cfs *ConferenceStore) LeaveConference(conferenceAPIId string, callAPIId string, at time.Time) (*model.ConferenceParticipant, error) {
+	tx, err := cfs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var conferenceId int
+	if err = tx.QueryRow("SELECT id FROM conferences WHERE api_id = ? FOR UPDATE", conferenceAPIId).Scan(&conferenceId); err != nil {
+		return nil, err
+	}
+	participant, err := scanParticipant(tx.QueryRow("SELECT "+participantColumns+" "+participantJoins+`
+		WHERE conference_participants.conference_id = ? AND calls.api_id = ? AND conference_participants.left_at IS NULL`, conferenceId, callAPIId))
+	if err != nil {
+		return nil, err
+	}
+	if err = leaveConference(tx, participant, at); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return participant, nil
+}
+
+/*
+Input: call api id, leave time
+Todo : Remove the call from every conference it is still in, used once the call has ended
+Output: If success return nil else return err
+*/
+func (cfs *ConferenceStore) LeaveAllConferences(callAPIId string, at time.Time) error {
+	rows, err := cfs.db.Query(`SELECT conferences.api_id `+participantJoins+`
+		WHERE calls.api_id = ? AND conference_participants.left_at IS NULL`, callAPIId)
+	if err != nil {
+		return err
+	}
+	conferenceAPIIds := make([]string, 0)
+	for rows.Next() {
+		var apiId string
+		if err := rows.Scan(&apiId); err != nil {
+			rows.Close()
+			return err
+		}
+		conferenceAPIIds = append(conferenceAPIIds, apiId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, conferenceAPIId := range conferenceAPIIds {
+		_, err := cfs.LeaveConference(conferenceAPIId, callAPIId, at)
+		// the participant may have left in the meantime
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+func leaveConference(tx *sql.Tx, participant *model.ConferenceParticipant, at time.Time) error {
+	duration := int(at.Sub(participant.JoinedAt).Seconds())
+	if duration < 0 {
+		duration = 0
+	}
+	_, err := tx.Exec("UPDATE conference_participants SET left_at = ?, duration = ?, updated_at = ? WHERE id = ?", at, duration, at, participant.Id)
+	if err != nil {
+		return err
+	}
+	participant.LeftAt = &at
+	participant.Duration = duration
+
+	var remaining int
+	row := tx.QueryRow("SELECT COUNT(*) FROM conference_participants WHERE session_id = ? AND left_at IS NULL", participant.SessionId)
+	if err = row.Scan(&remaining); err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return nil
+	}
+	_, err = tx.Exec("UPDATE conference_sessions SET ended_at = ?, duration = GREATEST(TIMESTAMPDIFF(SECOND, started_at, ?), 0), updated_at = ? WHERE id = ? AND ended_at IS NULL",
+		at, at, at, participant.SessionId)
+	return err
+}
+
+/*
+Input: conference api id, call api id, role
+Todo : Change the role of a call in the conference
+Output: First Value: ConferenceParticipant model, Second Value: error, sql.ErrNoRows when the call is not in the conference
+*/
+func (cfs *ConferenceStore) UpdateParticipantRole(conferenceAPIId string, callAPIId string, role string) (*model.ConferenceParticipant, error) {
+	participant, err := scanParticipant(cfs.db.QueryRow("SELECT "+participantColumns+" "+participantJoins+`
+		WHERE conferences.api_id = ? AND calls.api_id = ? AND conference_participants.left_at IS NULL`, conferenceAPIId, callAPIId))
+	if err != nil {
+		return nil, err
+	}
+	_, err = cfs.db.Exec("UPDATE conference_participants SET role = ?, updated_at = ? WHERE id = ?", role, time.Now(), participant.Id)
+	if err != nil {
+		return nil, err
+	}
+	participant.Role = role
+	return participant, nil
+}
+
+/*
+Input: conference api id
+Todo : Get the participants currently in the conference
+Output: First Value: list of ConferenceParticipant model, Second Value: error
+*/
+func (cfs *ConferenceStore) GetLiveParticipants(conferenceAPIId string) ([]*model.ConferenceParticipant, error) {
+	return cfs.getParticipants("conferences.api_id = ? AND conference_participants.left_at IS NULL", conferenceAPIId)
+}
+
+/*
+Input: session id
+Todo : Get everyone who took part in a conference session
+Output: First Value: list of ConferenceParticipant model, Second Value: error
+*/
+func (cfs *ConferenceStore) GetSessionParticipants(sessionId int) ([]*model.ConferenceParticipant, error) {
+	return cfs.getParticipants("conference_participants.session_id = ?", sessionId)
+}
+
+func (cfs *ConferenceStore) getParticipants(where string, args ...interface{}) ([]*model.ConferenceParticipant, error) {
+	rows, err := cfs.db.Query("SELECT "+participantColumns+" "+participantJoins+" WHERE "+where+" ORDER BY conference_participants.joined_at, conference_participants.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := make([]*model.ConferenceParticipant, 0)
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
+
+/*
+Input: conference api id, limit
+Todo : Get the latest sessions of the conference with their participant count and billable participant seconds.
+Seconds of participants still in a live session are added once they leave
+Output: First Value: list of ConferenceSession model, Second Value: error
+*/
+func (cfs *ConferenceStore) GetSessions(conferenceAPIId string, limit int) ([]*model.ConferenceSession, error) {
+	rows, err := cfs.db.Query(`SELECT conference_sessions.id, conference_sessions.conference_id, conference_sessions.workspace_id,
+		conference_sessions.started_at, conference_sessions.ended_at, conference_sessions.duration,
+		COUNT(conference_participants.id), COALESCE(SUM(conference_participants.duration), 0)
+		FROM conference_sessions
+		INNER JOIN conferences ON conferences.id = conference_sessions.conference_id
+		LEFT JOIN conference_participants ON conference_participants.session_id = conference_sessions.id
+		WHERE conferences.api_id = ?
+		GROUP BY conference_sessions.id
+		ORDER BY conference_sessions.id DESC
+		LIMIT ?`, conferenceAPIId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.ConferenceSession, 0)
+	for rows.Next() {
+		session := model.ConferenceSession{}
+		var endedAt sql.NullTime
+		err := rows.Scan(&session.Id, &session.ConferenceId, &session.WorkspaceId, &session.StartedAt, &endedAt, &session.Duration,
+			&session.Participants, &session.ParticipantSeconds)
+		if err != nil {
+			return nil, err
+		}
+		if endedAt.Valid {
+			session.EndedAt = &endedAt.Time
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
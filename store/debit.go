@@ -2,10 +2,9 @@ package store
 
 import (
 	"database/sql"
-	"fmt"
-	"math"
 	"time"
 
+	"lineblocs.com/api/metering"
 	"lineblocs.com/api/model"
 	"lineblocs.com/api/utils"
 )
@@ -26,61 +25,140 @@ func NewDebitStore(db *sql.DB) *DebitStore {
 
 /*
 Input: CallRate model, Debit Model
-Todo : Create new user_debit and store to db
-Output: If success return nil else return err
+Todo : Bill the call seconds with the billing scheme of the rate and store the user_debit with its audit fields
+Output: First Value: debitId, Second Value: error
+If success return (debitId, nil) else return (-1, err)
 */
-func (ds *DebitStore) CreateDebit(rate *model.CallRate, debit *model.Debit) error {
-	minutes := math.Floor(debit.Seconds / 60)
-	dollars := minutes * rate.CallRate
-	cents := utils.ToCents(dollars)
+func (ds *DebitStore) CreateDebit(rate *model.CallRate, debit *model.Debit) (int64, error) {
+	debit.BillableSeconds = utils.CalculateBillableSeconds(debit.Seconds, rate)
+	debit.BillingIncrement = rate.BillingIncrement
+	debit.MinimumDuration = rate.MinimumDuration
+	debit.Rate = rate.CallRate
+	dollars := utils.CalculateCallCost(debit.BillableSeconds, rate)
+	debit.Cents = utils.ToPreciseCents(dollars)
 	now := time.Now()
-	stmt, err := ds.db.Prepare("INSERT INTO users_debits (`user_id`, `cents`, `source`, `plan_snapshot`, `module_id`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ? )")
+	stmt, err := ds.db.Prepare("INSERT INTO users_debits (`user_id`, `workspace_id`, `cents`, `source`, `plan_snapshot`, `module_id`, `call_id`, `seconds`, `direction`, `billable_seconds`, `billing_increment`, `minimum_duration`, `rate`, `idempotency_key`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )")
 	if err != nil {
-		return err
+		return -1, err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(debit.UserId, cents, debit.Source, debit.PlanSnapshot, debit.ModuleId, now, now)
+	res, err := stmt.Exec(debit.UserId, debit.WorkspaceId, debit.Cents, debit.Source, debit.PlanSnapshot, debit.ModuleId, nullableId(debit.CallId), debit.Seconds, debit.Direction, debit.BillableSeconds, debit.BillingIncrement, debit.MinimumDuration, debit.Rate, nullableKey(debit.IdempotencyKey), now, now)
+	if isIdempotencyConflict(err, debit.IdempotencyKey) {
+		return -1, utils.ErrIdempotencyConflict
+	}
 	if err != nil {
-		return err
+		return -1, err
 	}
-	return nil
+	return res.LastInsertId()
 }
 
 /*
-Input: Workspace model, DebitAPI model
-Todo : Calculate cents based on debit type and create user_debit
-Output: If success return nil else return err
+Input: Workspace model
+Todo : Get the prepaid balance of a workspace, credits minus debits of every member of the workspace
+Output: First Value: balance in cents, Second Value: error
 */
-func (ds *DebitStore) CreateAPIUsageDebit(workspace *model.Workspace, debitApi *model.DebitAPI) error {
-	// Check DebitType and calcaulte cents individually
-	if debitApi.Type == "TTS" {
-		dollars := utils.CalculateTTSCosts(debitApi.Params.Length)
-		cents := utils.ToCents(dollars)
-		source := fmt.Sprintf("API usage - %s", debitApi.Type)
-		now := time.Now()
-		stmt, err := ds.db.Prepare("INSERT INTO users_debits (`user_id`, `cents`, `source`, `plan_snapshot`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ? )")
-		if err != nil {
-			return err
-		}
-		defer stmt.Close()
-		_, err = stmt.Exec(debitApi.UserId, cents, source, workspace.Plan, now, now)
-		if err != nil {
-			return err
-		}
-	} else if debitApi.Type == "STT" {
-		dollars := utils.CalculateSTTCosts(debitApi.Params.RecordingLength)
-		cents := utils.ToCents(dollars)
-		source := fmt.Sprintf("API usage - %s", debitApi.Type)
-		now := time.Now()
-		stmt, err := ds.db.Prepare("INSERT INTO users_debits (`user_id`, `cents`, `source`, `plan_snapshot`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ? )")
-		if err != nil {
-			return err
-		}
-		defer stmt.Close()
-		_, err = stmt.Exec(debitApi.UserId, cents, source, workspace.Plan, now, now)
+func (ds *DebitStore) GetWorkspaceBalance(workspace *model.Workspace) (float64, error) {
+	var credits float64
+	var debits float64
+	row := ds.db.QueryRow(`SELECT
+		(SELECT COALESCE(SUM(cents), 0) FROM users_credits WHERE workspace_id = ?),
+		(SELECT COALESCE(SUM(cents), 0) FROM users_debits WHERE workspace_id = ?)`, workspace.Id, workspace.Id)
+	err := row.Scan(&credits, &debits)
+	if err != nil {
+		return 0, err
+	}
+	return credits - debits, nil
+}
+
+/*
+Input: Workspace model, period start, period end
+Todo : Sum the user_debits of the workspace in the period grouped by source, direction and usage type
+Output: First Value: list of UsageSummaryLine model, Second Value: error
+*/
+func (ds *DebitStore) GetUsageSummary(workspace *model.Workspace, start time.Time, end time.Time) ([]*model.UsageSummaryLine, error) {
+	rows, err := ds.db.Query(`SELECT users_debits.source,
+		COALESCE(users_debits.direction, ''),
+		COALESCE(usage_events.usage_type, ''),
+		COUNT(*),
+		COALESCE(SUM(users_debits.seconds), 0),
+		COALESCE(SUM(users_debits.billable_seconds), 0),
+		COALESCE(SUM(usage_events.quantity), 0),
+		COALESCE(SUM(users_debits.cents), 0)
+		FROM users_debits
+		LEFT JOIN usage_events ON usage_events.id = users_debits.usage_event_id
+		WHERE users_debits.workspace_id = ?
+		AND users_debits.created_at >= ?
+		AND users_debits.created_at < ?
+		GROUP BY users_debits.source, users_debits.direction, usage_events.usage_type
+		ORDER BY users_debits.source, users_debits.direction`, workspace.Id, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]*model.UsageSummaryLine, 0)
+	for rows.Next() {
+		var line model.UsageSummaryLine
+		err := rows.Scan(&line.Source, &line.Direction, &line.UsageType, &line.Count, &line.Seconds, &line.BillableSeconds, &line.Quantity, &line.Cents)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		line.Category = metering.Category(line.UsageType)
+		lines = append(lines, &line)
+	}
+	return lines, rows.Err()
+}
+
+/*
+Input: Workspace model, day
+Todo : Sum the user_debits of the workspace created on the day
+Output: First Value: spend in cents, Second Value: error
+*/
+func (ds *DebitStore) GetDailySpend(workspace *model.Workspace, day time.Time) (float64, error) {
+	var cents float64
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	row := ds.db.QueryRow(`SELECT COALESCE(SUM(cents), 0) FROM users_debits
+		WHERE workspace_id = ? AND created_at >= ? AND created_at < ?`, workspace.Id, start, start.AddDate(0, 0, 1))
+	err := row.Scan(&cents)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return cents, nil
+}
+
+/*
+Input: Workspace model, alert type, period
+Todo : Claim a billing alert for the period so it is only sent once
+Output: First Value: true if the alert was not sent yet in the period, Second Value: error
+*/
+func (ds *DebitStore) ClaimBillingAlert(workspace *model.Workspace, alertType string, period string) (bool, error) {
+	now := time.Now()
+	stmt, err := ds.db.Prepare("INSERT INTO billing_alerts (`workspace_id`, `alert_type`, `period`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ? )")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(workspace.Id, alertType, period, now, now)
+	if isDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+/*
+Input: Workspace model, alert type, period
+Todo : Release the claim of a billing alert that could not be sent so a later debit sends it again
+Output: If success return nil else return err
+*/
+func (ds *DebitStore) ReleaseBillingAlert(workspace *model.Workspace, alertType string, period string) error {
+	_, err := ds.db.Exec("DELETE FROM billing_alerts WHERE `workspace_id` = ? AND `alert_type` = ? AND `period` = ?", workspace.Id, alertType, period)
+	return err
+}
+
+// Zero ids are stored as NULL, e.g. debits that are not for a call or calls without a parent
+func nullableId(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
 }
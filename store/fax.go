@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
 )
 
 /*
@@ -30,12 +31,22 @@ If success return (id, nil) else return (nil, err)
 func (fs *FaxStore) CreateFax(fax *model.Fax, name string, size int64, apiId string, plan string) (int64, error) {
 	now := time.Now()
 
-	stmt, err := fs.db.Prepare("INSERT INTO faxes (`uri`, `size`, `name`, `user_id`, `call_id`, `workspace_id`, `api_id`, `plan`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	var location nullableLocation
+	if fax.Location != nil {
+		location = nullableLocation{
+			backend: nullableKey(fax.Location.Backend),
+			region:  nullableKey(fax.Location.Region),
+			bucket:  nullableKey(fax.Location.Bucket)}
+	}
+	stmt, err := fs.db.Prepare("INSERT INTO faxes (`uri`, `storage_backend`, `storage_region`, `storage_bucket`, `size`, `name`, `user_id`, `call_id`, `workspace_id`, `api_id`, `plan`, `idempotency_key`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return -1, err
 	}
 	defer stmt.Close()
-	res, err := stmt.Exec(fax.Uri, size, name, fax.UserId, fax.CallId, fax.WorkspaceId, apiId, plan, now, now)
+	res, err := stmt.Exec(fax.Uri, location.backend, location.region, location.bucket, size, name, fax.UserId, fax.CallId, fax.WorkspaceId, apiId, plan, nullableKey(fax.IdempotencyKey), now, now)
+	if isIdempotencyConflict(err, fax.IdempotencyKey) {
+		return -1, utils.ErrIdempotencyConflict
+	}
 	if err != nil {
 		return -1, err
 	}
@@ -63,3 +74,37 @@ func (fs *FaxStore) GetFaxCount(id int) (*int, error) {
 	}
 	return &count, nil
 }
+
+/*
+Input: id
+Todo : Get fax with matching id
+Output: First Value: Fax model, Second Value: error
+If success return (Fax model, nil) else return (nil, err)
+*/
+func (fs *FaxStore) GetFaxFromDB(id int) (*model.Fax, error) {
+	return fs.getFax("id", id)
+}
+
+/*
+Input: apiId
+Todo : Get fax with matching api_id
+Output: First Value: Fax model, Second Value: error
+If success return (Fax model, nil) else return (nil, err)
+*/
+func (fs *FaxStore) GetFaxByAPIId(apiId string) (*model.Fax, error) {
+	return fs.getFax("api_id", apiId)
+}
+
+func (fs *FaxStore) getFax(column string, value interface{}) (*model.Fax, error) {
+	fax := model.Fax{}
+	var callId sql.NullInt64
+	var location nullableLocation
+	row := fs.db.QueryRow("SELECT user_id, workspace_id, call_id, uri, api_id, storage_backend, storage_region, storage_bucket FROM faxes WHERE "+column+" = ?", value)
+	err := row.Scan(&fax.UserId, &fax.WorkspaceId, &callId, &fax.Uri, &fax.APIId, &location.backend, &location.region, &location.bucket)
+	if err != nil {
+		return nil, err
+	}
+	fax.CallId = int(callId.Int64)
+	fax.Location = location.get()
+	return &fax, nil
+}
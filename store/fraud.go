@@ -0,0 +1,233 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/fraud"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Implementation of Fraud Store
+*/
+
+type FraudStore struct {
+	db *sql.DB
+}
+
+func NewFraudStore(db *sql.DB) *FraudStore {
+	return &FraudStore{
+		db: db,
+	}
+}
+
+/*
+Input: workspaceId
+Todo : Get the enabled fraud rules of the workspace. Workspace rules replace global rules of the same type,
+the default rules are used when none are configured
+Output: First Value: list of FraudRule model, Second Value: error
+*/
+func (fs *FraudStore) GetRules(workspaceId int) ([]*model.FraudRule, error) {
+	rows, err := fs.db.Query(`SELECT id, workspace_id, type, action, threshold, score, params
+		FROM fraud_rules
+		WHERE enabled = 1
+		AND (workspace_id = ? OR workspace_id IS NULL)
+		ORDER BY workspace_id IS NULL, id`, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]*model.FraudRule, 0)
+	workspaceTypes := make(map[string]bool)
+	for rows.Next() {
+		var rule model.FraudRule
+		var ruleWorkspaceId sql.NullInt64
+		var params sql.NullString
+		err := rows.Scan(&rule.Id, &ruleWorkspaceId, &rule.Type, &rule.Action, &rule.Threshold, &rule.Score, &params)
+		if err != nil {
+			return nil, err
+		}
+		if !fraud.IsKnownRule(rule.Type) || !fraud.IsKnownAction(rule.Action) {
+			utils.Log(logrus.WarnLevel, fmt.Sprintf("Skipping fraud rule %d with type %q and action %q", rule.Id, rule.Type, rule.Action))
+			continue
+		}
+		if params.Valid && params.String != "" {
+			if err := json.Unmarshal([]byte(params.String), &rule); err != nil {
+				utils.Log(logrus.WarnLevel, fmt.Sprintf("Skipping fraud rule %d with invalid params: %s", rule.Id, err.Error()))
+				continue
+			}
+		}
+		if ruleWorkspaceId.Valid {
+			id := int(ruleWorkspaceId.Int64)
+			rule.WorkspaceId = &id
+			workspaceTypes[rule.Type] = true
+		} else if workspaceTypes[rule.Type] {
+			continue
+		}
+		rules = append(rules, &rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rules) == 0 {
+		return fraud.DefaultRules(), nil
+	}
+	return rules, nil
+}
+
+/*
+Input: FraudCheck model
+Todo : Count the recent outbound calls, spend and new destination countries of the workspace
+Output: First Value: FraudActivity model, Second Value: error
+*/
+func (fs *FraudStore) GetActivity(check *model.FraudCheck) (*model.FraudActivity, error) {
+	activity := model.FraudActivity{}
+	lastMinute := check.At.Add(-time.Minute)
+	lastHour := check.At.Add(-time.Hour)
+
+	row := fs.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(`from` = ?), 0) FROM calls WHERE workspace_id = ? AND direction = 'outbound' AND created_at >= ?",
+		check.Extension, check.WorkspaceId, lastMinute)
+	err := row.Scan(&activity.WorkspaceCallsLastMinute, &activity.ExtensionCallsLastMinute)
+	if err != nil {
+		return nil, err
+	}
+
+	row = fs.db.QueryRow(`SELECT COALESCE(SUM(cents), 0) FROM users_debits WHERE workspace_id = ? AND created_at >= ?`, check.WorkspaceId, lastHour)
+	err = row.Scan(&activity.SpendLastHourCents)
+	if err != nil {
+		return nil, err
+	}
+
+	// Countries approved ahead of their first call have no first number and were not called
+	row = fs.db.QueryRow(`SELECT COUNT(*) FROM workspace_called_countries WHERE workspace_id = ? AND first_number <> '' AND created_at >= ?`, check.WorkspaceId, lastHour)
+	err = row.Scan(&activity.NewCountriesLastHour)
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+/*
+Input: FraudDecision model
+Todo : Store the decision with the reasons of every triggered rule
+Output: If success return nil else return err
+*/
+func (fs *FraudStore) LogDecision(decision *model.FraudDecision) error {
+	reasons, err := json.Marshal(decision.Reasons)
+	if err != nil {
+		return err
+	}
+	decision.CreatedAt = time.Now()
+	res, err := fs.db.Exec("INSERT INTO fraud_decisions (`workspace_id`, `call_api_id`, `extension`, `destination`, `action`, `score`, `reasons`, `suspended`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )",
+		decision.WorkspaceId, decision.CallAPIId, decision.Extension, decision.Destination, decision.Action, decision.Score, string(reasons), decision.Suspended, decision.CreatedAt, decision.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	decision.Id = int(id)
+	return nil
+}
+
+/*
+Input: workspaceId, limit
+Todo : Get the latest fraud decisions of the workspace
+Output: First Value: list of FraudDecision model, Second Value: error
+*/
+func (fs *FraudStore) GetDecisions(workspaceId int, limit int) ([]*model.FraudDecision, error) {
+	rows, err := fs.db.Query(`SELECT id, workspace_id, call_api_id, extension, destination, action, score, reasons, suspended, created_at
+		FROM fraud_decisions
+		WHERE workspace_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, workspaceId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := make([]*model.FraudDecision, 0)
+	for rows.Next() {
+		var decision model.FraudDecision
+		var reasons string
+		err := rows.Scan(&decision.Id, &decision.WorkspaceId, &decision.CallAPIId, &decision.Extension, &decision.Destination,
+			&decision.Action, &decision.Score, &reasons, &decision.Suspended, &decision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(reasons), &decision.Reasons); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, &decision)
+	}
+	return decisions, rows.Err()
+}
+
+/*
+Input: workspaceId, reason
+Todo : Suspend the workspace unless it is already suspended
+Output: First Value: true when a new suspension was created, Second Value: error
+*/
+func (fs *FraudStore) SuspendWorkspace(workspaceId int, reason string) (bool, error) {
+	now := time.Now()
+	res, err := fs.db.Exec(`INSERT INTO workspace_suspensions (workspace_id, reason, created_at, updated_at)
+		SELECT ?, ?, ?, ? FROM DUAL
+		WHERE NOT EXISTS (SELECT 1 FROM workspace_suspensions WHERE workspace_id = ? AND lifted_at IS NULL)`,
+		workspaceId, reason, now, now, workspaceId)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+/*
+Input: workspaceId
+Todo : Get the active suspension of the workspace
+Output: First Value: WorkspaceSuspension model, nil when the workspace is not suspended, Second Value: error
+*/
+func (fs *FraudStore) GetSuspension(workspaceId int) (*model.WorkspaceSuspension, error) {
+	suspension := model.WorkspaceSuspension{}
+	row := fs.db.QueryRow(`SELECT workspace_id, reason, created_at
+		FROM workspace_suspensions
+		WHERE workspace_id = ? AND lifted_at IS NULL
+		ORDER BY id DESC
+		LIMIT 1`, workspaceId)
+	err := row.Scan(&suspension.WorkspaceId, &suspension.Reason, &suspension.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &suspension, nil
+}
+
+/*
+Input: workspaceId
+Todo : Lift the active suspension of the workspace
+Output: First Value: true when a suspension was lifted, Second Value: error
+*/
+func (fs *FraudStore) LiftSuspension(workspaceId int) (bool, error) {
+	now := time.Now()
+	res, err := fs.db.Exec("UPDATE workspace_suspensions SET lifted_at = ?, updated_at = ? WHERE workspace_id = ? AND lifted_at IS NULL", now, now, workspaceId)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"lineblocs.com/api/idempotency"
+)
+
+/*
+Implementation of Idempotency Store
+*/
+
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewIdempotencyStore(db *sql.DB) *IdempotencyStore {
+	return &IdempotencyStore{
+		db: db,
+	}
+}
+
+// MySQL error number for a unique index violation
+const mysqlDuplicateEntry = 1062
+
+/*
+Input: table, workspaceId, key
+Todo : Find the row that was created by an earlier request of the workspace with the same idempotency key
+Output: First Value: id of the row, Second Value: error
+If found return (id, nil), not found return (0, sql.ErrNoRows) else return (0, err)
+*/
+func (is *IdempotencyStore) LookupIdempotencyKey(table string, workspaceId int, key string) (int64, error) {
+	switch table {
+	case idempotency.Debits, idempotency.Calls, idempotency.Recordings, idempotency.Faxes:
+	default:
+		return 0, fmt.Errorf("table %s does not support idempotency keys", table)
+	}
+	var id int64
+	row := is.db.QueryRow("SELECT id FROM `"+table+"` WHERE `workspace_id` = ? AND `idempotency_key` = ?", workspaceId, key)
+	err := row.Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Store empty idempotency keys as NULL so the unique index only applies to requests that send one
+func nullableKey(key string) sql.NullString {
+	return sql.NullString{String: key, Valid: key != ""}
+}
+
+// Suffix of the per-workspace unique indexes on idempotency keys
+const idempotencyKeyIndex = "_workspace_id_idempotency_key_unique"
+
+// Check if an insert failed on a unique index
+func isDuplicateKeyError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// Check if an insert failed because another request with the same idempotency key got there first,
+// duplicates on any other unique index are not a replay of the request
+func isIdempotencyConflict(err error, key string) bool {
+	var mysqlErr *mysql.MySQLError
+	return key != "" && errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry &&
+		strings.Contains(mysqlErr.Message, idempotencyKeyIndex)
+}
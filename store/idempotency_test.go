@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestNullableKey(t *testing.T) {
+	if key := nullableKey(""); key.Valid {
+		t.Error("empty key is not NULL")
+	}
+	if key := nullableKey("abc"); !key.Valid || key.String != "abc" {
+		t.Errorf("got %+v", key)
+	}
+}
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	duplicate := &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry 'abc' for key 'calls_workspace_id_idempotency_key_unique'"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"duplicate entry", duplicate, true},
+		{"wrapped", fmt.Errorf("insert: %w", duplicate), true},
+		{"other mysql error", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, false},
+		{"not a mysql error", errors.New("connection refused"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicateKeyError(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIdempotencyConflict(t *testing.T) {
+	keyConflict := &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry '4-abc' for key 'users_debits.users_debits_workspace_id_idempotency_key_unique'"}
+	otherConflict := &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry 'CA-1' for key 'calls_api_id_unique'"}
+	tests := []struct {
+		name string
+		err  error
+		key  string
+		want bool
+	}{
+		{"idempotency key index", keyConflict, "abc", true},
+		{"wrapped", fmt.Errorf("insert: %w", keyConflict), "abc", true},
+		{"request without a key", keyConflict, "", false},
+		{"another unique index", otherConflict, "abc", false},
+		{"other mysql error", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, "abc", false},
+		{"nil", nil, "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIdempotencyConflict(tt.err, tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -65,7 +65,9 @@ func (ls *LoggerStore) StartLogRoutine(workspace *model.Workspace, log *model.Lo
 	}
 	logIdStr := strconv.FormatInt(logId, 10)
 
-	go sendLogRoutineEmail(log, user, workspace)
+	if !log.SkipEmail {
+		go sendLogRoutineEmail(log, user, workspace)
+	}
 
 	return &logIdStr, err
 }
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"lineblocs.com/api/metering"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Implementation of Metering Store
+*/
+
+type MeteringStore struct {
+	db *sql.DB
+}
+
+func NewMeteringStore(db *sql.DB) *MeteringStore {
+	return &MeteringStore{
+		db: db,
+	}
+}
+
+/*
+Input: Workspace model, Plan model, UsageEvent model
+Todo : Record the usage event in the usage_events ledger, then bill the part above the plan allowance as a user_debit
+Output: First Value: recorded UsageEvent model, Second Value: error
+If success return (UsageEvent model, nil) else return (nil, err)
+*/
+func (ms *MeteringStore) RecordUsage(workspace *model.Workspace, plan *model.Plan, event *model.UsageEvent) (*model.UsageEvent, error) {
+	usageType, err := metering.LookupUsageType(event.Type)
+	if err != nil {
+		return nil, err
+	}
+	event.Type = usageType.Name
+	event.WorkspaceId = workspace.Id
+
+	event.UnitPrice, err = ms.getUnitPrice(usageType, workspace.Plan)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Usage already recorded this month decides how much of the allowance is left
+	var used float64
+	periodStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	row := tx.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM usage_events
+		WHERE workspace_id = ? AND usage_type = ? AND created_at >= ? FOR UPDATE`, workspace.Id, event.Type, periodStart)
+	if err := row.Scan(&used); err != nil {
+		return nil, err
+	}
+	included := metering.IncludedQuantity(plan, event.Type)
+	event.BillableQuantity = math.Max(0, used+event.Quantity-included) - math.Max(0, used-included)
+	event.Cents = utils.ToPreciseCents(event.BillableQuantity * event.UnitPrice)
+
+	res, err := tx.Exec("INSERT INTO usage_events (`workspace_id`, `user_id`, `usage_type`, `quantity`, `billable_quantity`, `unit_price`, `cents`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ? )",
+		event.WorkspaceId, event.UserId, event.Type, event.Quantity, event.BillableQuantity, event.UnitPrice, event.Cents, now, now)
+	if err != nil {
+		return nil, err
+	}
+	event.Id, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	source := fmt.Sprintf("API usage - %s", event.Type)
+	res, err = tx.Exec("INSERT INTO users_debits (`user_id`, `workspace_id`, `cents`, `source`, `plan_snapshot`, `usage_event_id`, `idempotency_key`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ? )",
+		event.UserId, event.WorkspaceId, event.Cents, source, workspace.Plan, event.Id, nullableKey(event.IdempotencyKey), now, now)
+	if isIdempotencyConflict(err, event.IdempotencyKey) {
+		return nil, utils.ErrIdempotencyConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.DebitId, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE usage_events SET `debit_id` = ? WHERE `id` = ?", event.DebitId, event.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+/*
+Input: Workspace model
+Todo : Get every usage type with the unit price that applies to the workspace plan
+Output: First Value: list of UsageType model, Second Value: error
+*/
+func (ms *MeteringStore) GetUsageTypes(workspace *model.Workspace) ([]*model.UsageType, error) {
+	types := metering.UsageTypes()
+	result := make([]*model.UsageType, 0, len(types))
+	for i := range types {
+		price, err := ms.getUnitPrice(types[i], workspace.Plan)
+		if err != nil {
+			return nil, err
+		}
+		types[i].UnitPrice = price
+		result = append(result, &types[i])
+	}
+	return result, nil
+}
+
+// A price configured for the plan wins over a global price, which wins over the registry default
+func (ms *MeteringStore) getUnitPrice(usageType model.UsageType, plan string) (float64, error) {
+	var price float64
+	row := ms.db.QueryRow(`SELECT unit_price FROM usage_prices
+		WHERE usage_type = ? AND (plan = ? OR plan IS NULL)
+		ORDER BY plan IS NULL
+		LIMIT 1`, usageType.Name, plan)
+	err := row.Scan(&price)
+	if err == sql.ErrNoRows {
+		return usageType.UnitPrice, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return price, nil
+}
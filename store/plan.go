@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Implementation of Plan Store
+Plans are read from the JSON file in PLANS_CONFIG_FILE when it is set, otherwise from the plans table.
+Workspaces on a plan that is not defined get the plan named by DEFAULT_PLAN
+*/
+
+type PlanStore struct {
+	db *sql.DB
+}
+
+func NewPlanStore(db *sql.DB) *PlanStore {
+	return &PlanStore{
+		db: db,
+	}
+}
+
+var (
+	configuredPlans     map[string]*model.Plan
+	configuredPlansOnce sync.Once
+)
+
+/*
+Input: workspace
+Todo : Get the plan the workspace is subscribed to, the default plan when its plan is not defined
+Output: First Value: Plan model, Second Value: error
+If success return (Plan model, nil) else return (nil, err)
+*/
+func (ps *PlanStore) GetPlan(workspace *model.Workspace) (*model.Plan, error) {
+	return getWorkspacePlan(workspace.Plan, func(name string) (*model.Plan, error) {
+		return getPlanByName(ps.db, name)
+	})
+}
+
+/*
+Input: name
+Todo : Get plan with matching name
+Output: First Value: Plan model, Second Value: error
+If success return (Plan model, nil) else return (nil, err)
+*/
+func (ps *PlanStore) GetPlanByName(name string) (*model.Plan, error) {
+	return getPlanByName(ps.db, name)
+}
+
+/*
+Todo : Get every defined plan ordered by name
+Output: First Value: list of Plan model, Second Value: error
+If success return (plans, nil) else return (nil, err)
+*/
+func (ps *PlanStore) GetPlans() ([]*model.Plan, error) {
+	if plans := loadConfiguredPlans(); plans != nil {
+		result := make([]*model.Plan, 0, len(plans))
+		for _, plan := range plans {
+			result = append(result, plan)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+		return result, nil
+	}
+
+	rows, err := ps.db.Query(planQuery + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make([]*model.Plan, 0)
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+const planQuery = `SELECT name, monthly_fee, recording_storage_mb, fax_limit, concurrent_call_limit, extension_limit,
+	conference_participant_limit, tts_characters_included, stt_seconds_included, trial_days
+	FROM plans`
+
+func getPlanByName(db *sql.DB, name string) (*model.Plan, error) {
+	if plans := loadConfiguredPlans(); plans != nil {
+		plan, ok := plans[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", utils.ErrUnknownPlan, name)
+		}
+		return plan, nil
+	}
+
+	plan, err := scanPlan(db.QueryRow(planQuery+" WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", utils.ErrUnknownPlan, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// A workspace whose plan was removed or renamed keeps working with the limits of the default plan
+func getWorkspacePlan(name string, lookup func(string) (*model.Plan, error)) (*model.Plan, error) {
+	plan, err := lookup(name)
+	if !errors.Is(err, utils.ErrUnknownPlan) {
+		return plan, err
+	}
+	fallback := utils.Config("DEFAULT_PLAN")
+	if fallback == "" {
+		fallback = utils.DefaultPlan
+	}
+	if fallback == name {
+		return nil, err
+	}
+	utils.Log(logrus.WarnLevel, fmt.Sprintf("Plan %q is not defined, using the %s plan", name, fallback))
+	return lookup(fallback)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Either the db or a transaction
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanPlan(row rowScanner) (*model.Plan, error) {
+	var plan model.Plan
+	var recordingStorage, faxLimit, concurrentCalls, extensions, conferenceParticipants sql.NullInt64
+	err := row.Scan(&plan.Name,
+		&plan.MonthlyFee,
+		&recordingStorage,
+		&faxLimit,
+		&concurrentCalls,
+		&extensions,
+		&conferenceParticipants,
+		&plan.TTSCharactersIncluded,
+		&plan.STTSecondsIncluded,
+		&plan.TrialDays)
+	if err != nil {
+		return nil, err
+	}
+	plan.RecordingStorageMB = nullableLimit(recordingStorage)
+	plan.FaxLimit = nullableLimit(faxLimit)
+	plan.ConcurrentCallLimit = nullableLimit(concurrentCalls)
+	plan.ExtensionLimit = nullableLimit(extensions)
+	plan.ConferenceLimit = nullableLimit(conferenceParticipants)
+	return &plan, nil
+}
+
+func nullableLimit(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	limit := int(value.Int64)
+	return &limit
+}
+
+// Plans from the config file are loaded once, a broken file falls back to the plans table
+func loadConfiguredPlans() map[string]*model.Plan {
+	configuredPlansOnce.Do(func() {
+		path := utils.Config("PLANS_CONFIG_FILE")
+		if path == "" {
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not read plans config %s: %s", path, err.Error()))
+			return
+		}
+		var plans []*model.Plan
+		if err := json.Unmarshal(content, &plans); err != nil {
+			utils.Log(logrus.ErrorLevel, fmt.Sprintf("Could not parse plans config %s: %s", path, err.Error()))
+			return
+		}
+		configuredPlans = make(map[string]*model.Plan, len(plans))
+		for _, plan := range plans {
+			configuredPlans[plan.Name] = plan
+		}
+	})
+	return configuredPlans
+}
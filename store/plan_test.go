@@ -0,0 +1,58 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+func TestGetWorkspacePlan(t *testing.T) {
+	plans := map[string]*model.Plan{
+		"pro":           {Name: "pro"},
+		"pay-as-you-go": {Name: "pay-as-you-go"},
+		"starter":       {Name: "starter"},
+	}
+	dbErr := errors.New("connection refused")
+	lookup := func(name string) (*model.Plan, error) {
+		if name == "broken" {
+			return nil, dbErr
+		}
+		plan, ok := plans[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", utils.ErrUnknownPlan, name)
+		}
+		return plan, nil
+	}
+
+	tests := []struct {
+		name        string
+		plan        string
+		defaultPlan string
+		want        string
+		wantErr     error
+	}{
+		{"defined plan", "pro", "", "pro", nil},
+		{"unknown plan", "gold", "", "pay-as-you-go", nil},
+		{"configured default", "gold", "starter", "starter", nil},
+		{"default not defined", "gold", "platinum", "", utils.ErrUnknownPlan},
+		{"unknown default plan itself", "platinum", "platinum", "", utils.ErrUnknownPlan},
+		{"lookup error", "broken", "", "", dbErr},
+	}
+	defer os.Unsetenv("DEFAULT_PLAN")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("DEFAULT_PLAN", tt.defaultPlan)
+			plan, err := getWorkspacePlan(tt.plan, lookup)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && plan.Name != tt.want {
+				t.Errorf("plan = %s, want %s", plan.Name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/quality"
+)
+
+/*
+Implementation of Quality Store
+*/
+
+type QualityStore struct {
+	db *sql.DB
+}
+
+func NewQualityStore(db *sql.DB) *QualityStore {
+	return &QualityStore{
+		db: db,
+	}
+}
+
+/*
+Input: QualityReport model
+Todo : Store the RTP stats of a call leg, the provider and media server of the call are kept with the report
+Output: First Value: LastInsertId, Second Value: error
+If success return (id, nil) else return (-1, err), if the call is not found return sql.ErrNoRows
+*/
+func (qs *QualityStore) CreateQualityReport(report *model.QualityReport) (int64, error) {
+	var providerId sql.NullInt64
+	var mediaServerIp sql.NullString
+	row := qs.db.QueryRow("SELECT `id`, `provider_id`, `media_server_ip` FROM calls WHERE `api_id` = ?", report.CallAPIId)
+	err := row.Scan(&report.CallId, &providerId, &mediaServerIp)
+	if err != nil {
+		return -1, err
+	}
+	report.ProviderId = int(providerId.Int64)
+	if report.MediaServerIp == "" {
+		report.MediaServerIp = mediaServerIp.String
+	}
+
+	now := time.Now()
+	stmt, err := qs.db.Prepare("INSERT INTO call_quality_reports (`call_id`, `leg`, `mos`, `jitter_ms`, `packet_loss_pct`, `rtt_ms`, `codec`, `provider_id`, `media_server_ip`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )")
+	if err != nil {
+		return -1, err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(report.CallId, report.Leg, report.MOS, report.JitterMs, report.PacketLossPct, report.RTTMs, report.Codec, nullableId(report.ProviderId), report.MediaServerIp, now, now)
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+/*
+Input: call api id
+Todo : Get the quality reports of every leg of a call
+Output: First Value: list of QualityReport model, Second Value: error
+*/
+func (qs *QualityStore) GetQualityReports(callAPIId string) ([]*model.QualityReport, error) {
+	rows, err := qs.db.Query(`SELECT call_quality_reports.id, calls.api_id, call_quality_reports.call_id, call_quality_reports.leg,
+		call_quality_reports.mos, call_quality_reports.jitter_ms, call_quality_reports.packet_loss_pct, call_quality_reports.rtt_ms,
+		call_quality_reports.codec, call_quality_reports.provider_id, call_quality_reports.media_server_ip, call_quality_reports.created_at
+		FROM call_quality_reports
+		INNER JOIN calls ON calls.id = call_quality_reports.call_id
+		WHERE calls.api_id = ?
+		ORDER BY call_quality_reports.id`, callAPIId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]*model.QualityReport, 0)
+	for rows.Next() {
+		var report model.QualityReport
+		var providerId sql.NullInt64
+		var createdAt time.Time
+		err := rows.Scan(&report.Id, &report.CallAPIId, &report.CallId, &report.Leg, &report.MOS, &report.JitterMs, &report.PacketLossPct, &report.RTTMs,
+			&report.Codec, &providerId, &report.MediaServerIp, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		report.ProviderId = int(providerId.Int64)
+		report.CreatedAt = createdAt.Format(time.RFC3339)
+		reports = append(reports, &report)
+	}
+	return reports, rows.Err()
+}
+
+/*
+Input: group by (provider or media_server), period start, period end
+Todo : Aggregate the quality reports of the period per provider or per media server
+Output: First Value: list of QualityStats model, worst average MOS first, Second Value: error
+*/
+func (qs *QualityStore) GetQualityStats(groupBy string, start time.Time, end time.Time) ([]*model.QualityStats, error) {
+	var column string
+	switch groupBy {
+	case quality.GroupByProvider:
+		column = "COALESCE(CAST(provider_id AS CHAR), '')"
+	case quality.GroupByMediaServer:
+		column = "media_server_ip"
+	default:
+		return nil, fmt.Errorf("cannot group quality stats by %q", groupBy)
+	}
+
+	rows, err := qs.db.Query(fmt.Sprintf(`SELECT %[1]s,
+		COUNT(*),
+		AVG(mos),
+		MIN(mos),
+		AVG(jitter_ms),
+		AVG(packet_loss_pct),
+		AVG(rtt_ms),
+		SUM(mos < ?)
+		FROM call_quality_reports
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY %[1]s
+		ORDER BY AVG(mos)`, column), quality.PoorMOS, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*model.QualityStats, 0)
+	for rows.Next() {
+		stat := model.QualityStats{GroupBy: groupBy}
+		err := rows.Scan(&stat.Key, &stat.Reports, &stat.AvgMOS, &stat.MinMOS, &stat.AvgJitterMs, &stat.AvgPacketLossPct, &stat.AvgRTTMs, &stat.PoorReports)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, &stat)
+	}
+	return stats, rows.Err()
+}
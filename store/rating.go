@@ -0,0 +1,341 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lineblocs.com/api/model"
+	"lineblocs.com/api/utils"
+)
+
+/*
+Implementation of Rating Store
+*/
+
+type RatingStore struct {
+	db *sql.DB
+}
+
+func NewRatingStore(db *sql.DB) *RatingStore {
+	return &RatingStore{
+		db: db,
+	}
+}
+
+/*
+Input: Workspace model, number, callType
+Todo : Rate a call by call type and plan. PSTN calls are rated with the longest matching dial prefix,
+SIP and WebRTC calls use the flat rate of the workspace plan
+Output: First Value: CallRate model, Second Value: error
+If success return (CallRate model, nil) else return (nil, err), utils.ErrNoCallRate if nothing matches
+*/
+func (rs *RatingStore) LookupBestCallRate(workspace *model.Workspace, number string, callType string) (*model.CallRate, error) {
+	callType = utils.NormalizeCallType(callType)
+
+	var rates []*model.CallRate
+	var schemes map[*model.CallRate]billingScheme
+	var err error
+	switch callType {
+	case model.CallTypePSTN:
+		rates, schemes, err = rs.getPSTNRates(number)
+	case model.CallTypeSIP, model.CallTypeWebRTC:
+		rates, schemes, err = rs.getPlanRates(workspace.Plan, callType)
+	default:
+		return nil, utils.ErrNoCallRate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := utils.LookupBestCallRate(number, callType, rates)
+	if err != nil {
+		return nil, err
+	}
+	planScheme, err := rs.getPlanBillingScheme(workspace.Plan, callType)
+	if err != nil {
+		return nil, err
+	}
+	resolveBillingScheme(rate, schemes[rate], planScheme)
+	rate.Plan = workspace.Plan
+	return rate, nil
+}
+
+// Provider rates come from the newest rate deck that is already effective. Providers without any
+// effective rate deck keep using their sip_providers_rates.
+const activeProviderRatesQuery = `SELECT sip_providers.id,
+	sip_providers.name,
+	sip_providers.dial_prefix,
+	0 AS rate_ref_id,
+	rate_decks.id AS rate_deck_id,
+	rate_deck_entries.rate,
+	rate_deck_entries.dial_prefix,
+	NULL AS billing_increment,
+	NULL AS minimum_duration,
+	NULL AS minimum_charge
+	FROM sip_providers
+	INNER JOIN rate_decks ON rate_decks.provider_id = sip_providers.id
+	INNER JOIN rate_deck_entries ON rate_deck_entries.rate_deck_id = rate_decks.id
+	WHERE (sip_providers.type_of_provider = 'outbound'
+	OR sip_providers.type_of_provider = 'both')
+	AND sip_providers.active = 1
+	AND rate_decks.id = (SELECT latest.id FROM rate_decks latest
+		WHERE latest.provider_id = sip_providers.id
+		AND latest.effective_from <= ?
+		ORDER BY latest.effective_from DESC, latest.id DESC
+		LIMIT 1)
+	AND ? LIKE CONCAT(rate_deck_entries.dial_prefix, '%')
+	UNION ALL
+	SELECT sip_providers.id,
+	sip_providers.name,
+	sip_providers.dial_prefix,
+	sip_providers_rates.rate_ref_id,
+	0 AS rate_deck_id,
+	sip_providers_rates.rate,
+	call_rates_dial_prefixes.dial_prefix,
+	call_rates.billing_increment,
+	call_rates.minimum_duration,
+	call_rates.minimum_charge
+	FROM sip_providers
+	INNER JOIN sip_providers_rates ON sip_providers_rates.provider_id = sip_providers.id
+	INNER JOIN call_rates_dial_prefixes ON call_rates_dial_prefixes.call_rate_id = sip_providers_rates.rate_ref_id
+	INNER JOIN call_rates ON call_rates.id = sip_providers_rates.rate_ref_id
+	WHERE (sip_providers.type_of_provider = 'outbound'
+	OR sip_providers.type_of_provider = 'both')
+	AND sip_providers.active = 1
+	AND NOT EXISTS (SELECT 1 FROM rate_decks
+		WHERE rate_decks.provider_id = sip_providers.id
+		AND rate_decks.effective_from <= ?)
+	AND ? LIKE CONCAT(call_rates_dial_prefixes.dial_prefix, '%')`
+
+type providerRate struct {
+	rate       *model.CallRate
+	scheme     billingScheme
+	name       string
+	techPrefix string
+}
+
+// Billing scheme columns as stored on a rate or plan, unset columns fall through to the next level
+type billingScheme struct {
+	increment     sql.NullInt64
+	minimum       sql.NullInt64
+	minimumCharge sql.NullFloat64
+}
+
+/*
+Input: db, number, at
+Todo : Get the rates of all active outbound providers whose dial prefix matches the number at the given time
+Output: First Value: providerRate slice, Second Value: error
+*/
+func queryActiveProviderRates(db *sql.DB, number string, at time.Time) ([]*providerRate, error) {
+	digits := utils.NormalizeDialNumber(number)
+	results, err := db.Query(activeProviderRatesQuery, at, digits, at, digits)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	rates := make([]*providerRate, 0)
+	for results.Next() {
+		var techPrefix sql.NullString
+		value := providerRate{rate: &model.CallRate{CallType: model.CallTypePSTN}}
+		err = results.Scan(
+			&value.rate.ProviderId,
+			&value.name,
+			&techPrefix,
+			&value.rate.RateRefId,
+			&value.rate.RateDeckId,
+			&value.rate.CallRate,
+			&value.rate.DialPrefix,
+			&value.scheme.increment,
+			&value.scheme.minimum,
+			&value.scheme.minimumCharge)
+		if err != nil {
+			return nil, err
+		}
+		value.techPrefix = techPrefix.String
+		rates = append(rates, &value)
+	}
+	return rates, results.Err()
+}
+
+/*
+Input: number
+Todo : Get the provider rates whose dial prefix matches the number
+Output: First Value: CallRate model slice, Second Value: billing scheme of every rate, Third Value: error
+*/
+func (rs *RatingStore) getPSTNRates(number string) ([]*model.CallRate, map[*model.CallRate]billingScheme, error) {
+	providerRates, err := queryActiveProviderRates(rs.db, number, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	rates := make([]*model.CallRate, 0, len(providerRates))
+	schemes := make(map[*model.CallRate]billingScheme)
+	for _, value := range providerRates {
+		rates = append(rates, value.rate)
+		schemes[value.rate] = value.scheme
+	}
+	return rates, schemes, nil
+}
+
+/*
+Input: plan, callType
+Todo : Get the flat per minute rate of a plan for on-net call types
+Output: First Value: CallRate model slice, Second Value: billing scheme of every rate, Third Value: error
+*/
+func (rs *RatingStore) getPlanRates(plan string, callType string) ([]*model.CallRate, map[*model.CallRate]billingScheme, error) {
+	results, err := rs.db.Query(`SELECT rate, billing_increment, minimum_duration, minimum_charge
+		FROM plan_call_rates
+		WHERE plan = ?
+		AND call_type = ?
+		AND rate IS NOT NULL`, plan, callType)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer results.Close()
+
+	rates := make([]*model.CallRate, 0)
+	schemes := make(map[*model.CallRate]billingScheme)
+	for results.Next() {
+		var scheme billingScheme
+		rate := model.CallRate{CallType: callType}
+		err = results.Scan(&rate.CallRate, &scheme.increment, &scheme.minimum, &scheme.minimumCharge)
+		if err != nil {
+			return nil, nil, err
+		}
+		rates = append(rates, &rate)
+		schemes[&rate] = scheme
+	}
+	return rates, schemes, results.Err()
+}
+
+/*
+Input: plan, callType
+Todo : Get the billing scheme a plan uses for a call type, a PSTN row only needs the scheme columns
+Output: First Value: billingScheme, Second Value: error
+*/
+func (rs *RatingStore) getPlanBillingScheme(plan string, callType string) (billingScheme, error) {
+	var scheme billingScheme
+	row := rs.db.QueryRow(`SELECT billing_increment, minimum_duration, minimum_charge
+		FROM plan_call_rates
+		WHERE plan = ?
+		AND call_type = ?
+		LIMIT 1`, plan, callType)
+	err := row.Scan(&scheme.increment, &scheme.minimum, &scheme.minimumCharge)
+	if err != nil && err != sql.ErrNoRows {
+		return scheme, err
+	}
+	return scheme, nil
+}
+
+// Fill in the billing scheme of a rate. Values set on the rate win over the plan, 60/60 with no
+// minimum charge is used when neither sets them
+func resolveBillingScheme(rate *model.CallRate, rateScheme, planScheme billingScheme) {
+	rate.BillingIncrement = utils.DefaultBillingIncrement
+	rate.MinimumDuration = utils.DefaultMinimumDuration
+	rate.MinimumCharge = 0
+	for _, scheme := range []billingScheme{planScheme, rateScheme} {
+		if scheme.increment.Valid && scheme.increment.Int64 > 0 {
+			rate.BillingIncrement = int(scheme.increment.Int64)
+		}
+		if scheme.minimum.Valid {
+			rate.MinimumDuration = int(scheme.minimum.Int64)
+		}
+		if scheme.minimumCharge.Valid {
+			rate.MinimumCharge = scheme.minimumCharge.Float64
+		}
+	}
+}
+
+/*
+Input: providerId, name, RateDeckEntry model slice
+Todo : Store every effective date of a deck as its own version. Versions switch automatically once
+their effective date has passed
+Output: First Value: created RateDeck model slice, Second Value: error
+If success return (RateDeck slice, nil) else return (nil, err)
+*/
+func (rs *RatingStore) ImportRateDeck(providerId int, name string, entries []*model.RateDeckEntry) ([]*model.RateDeck, error) {
+	decks := utils.BuildRateDeckVersions(providerId, name, entries)
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, deck := range decks {
+		var id int
+		row := tx.QueryRow("SELECT id FROM rate_decks WHERE provider_id = ? AND effective_from = ?", providerId, deck.EffectiveFrom)
+		err = row.Scan(&id)
+		if err == nil {
+			return nil, fmt.Errorf("%w: %s", utils.ErrRateDeckExists, deck.EffectiveFrom.Format("2006-01-02 15:04:05"))
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		res, err := tx.Exec("INSERT INTO rate_decks (`provider_id`, `name`, `effective_from`, `entry_count`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ? )",
+			providerId, name, deck.EffectiveFrom, deck.EntryCount, now, now)
+		if err != nil {
+			return nil, err
+		}
+		deckId, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		deck.Id = int(deckId)
+
+		stmt, err := tx.Prepare("INSERT INTO rate_deck_entries (`rate_deck_id`, `dial_prefix`, `country`, `rate`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ? )")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range deck.Entries {
+			_, err = stmt.Exec(deckId, entry.DialPrefix, entry.Country, entry.Rate, now, now)
+			if err != nil {
+				stmt.Close()
+				return nil, err
+			}
+		}
+		stmt.Close()
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return decks, nil
+}
+
+/*
+Input: providerId
+Todo : Get all rate deck versions of a provider and flag the one currently in use
+Output: First Value: RateDeck model slice, Second Value: error
+*/
+func (rs *RatingStore) GetRateDecks(providerId int) ([]*model.RateDeck, error) {
+	results, err := rs.db.Query(`SELECT id, provider_id, name, effective_from, entry_count
+		FROM rate_decks
+		WHERE provider_id = ?
+		ORDER BY effective_from DESC, id DESC`, providerId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	now := time.Now()
+	foundActive := false
+	decks := make([]*model.RateDeck, 0)
+	for results.Next() {
+		deck := model.RateDeck{}
+		err = results.Scan(&deck.Id, &deck.ProviderId, &deck.Name, &deck.EffectiveFrom, &deck.EntryCount)
+		if err != nil {
+			return nil, err
+		}
+		// newest deck that is already effective
+		if !foundActive && !deck.EffectiveFrom.After(now) {
+			deck.Active = true
+			foundActive = true
+		}
+		decks = append(decks, &deck)
+	}
+	return decks, results.Err()
+}
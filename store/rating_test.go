@@ -0,0 +1,44 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"lineblocs.com/api/model"
+)
+
+func TestResolveBillingScheme(t *testing.T) {
+	unset := billingScheme{}
+	plan := billingScheme{
+		increment:     sql.NullInt64{Int64: 30, Valid: true},
+		minimum:       sql.NullInt64{Int64: 30, Valid: true},
+		minimumCharge: sql.NullFloat64{Float64: 0.01, Valid: true},
+	}
+	rate := billingScheme{
+		increment: sql.NullInt64{Int64: 6, Valid: true},
+		minimum:   sql.NullInt64{Int64: 0, Valid: true},
+	}
+	tests := []struct {
+		name          string
+		rate          billingScheme
+		plan          billingScheme
+		wantIncrement int
+		wantMinimum   int
+		wantCharge    float64
+	}{
+		{"defaults", unset, unset, 60, 60, 0},
+		{"plan scheme", unset, plan, 30, 30, 0.01},
+		{"rate wins over plan", rate, plan, 6, 0, 0.01},
+		{"zero increment is ignored", billingScheme{increment: sql.NullInt64{Valid: true}}, unset, 60, 60, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callRate := &model.CallRate{BillingIncrement: 1, MinimumDuration: 1, MinimumCharge: 1}
+			resolveBillingScheme(callRate, tt.rate, tt.plan)
+			if callRate.BillingIncrement != tt.wantIncrement || callRate.MinimumDuration != tt.wantMinimum || callRate.MinimumCharge != tt.wantCharge {
+				t.Errorf("got %d/%d min %g, want %d/%d min %g", callRate.MinimumDuration, callRate.BillingIncrement, callRate.MinimumCharge,
+					tt.wantMinimum, tt.wantIncrement, tt.wantCharge)
+			}
+		})
+	}
+}
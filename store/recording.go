@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"lineblocs.com/api/model"
+	"lineblocs.com/api/recording"
 	"lineblocs.com/api/utils"
 )
 
@@ -34,7 +35,7 @@ func (rs *RecordingStore) CreateRecording(workspace *model.Workspace, recording
 	now := time.Now()
 
 	// Perform a db.Query insert
-	stmt, err := rs.db.Prepare("INSERT INTO recordings (`user_id`, `call_id`, `workspace_id`, `status`, `name`, `uri`, `tag`, `api_id`, `plan_snapshot`, `storage_id`, `storage_server_ip`, `trim`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	stmt, err := rs.db.Prepare("INSERT INTO recordings (`user_id`, `call_id`, `workspace_id`, `status`, `name`, `uri`, `tag`, `api_id`, `plan_snapshot`, `storage_id`, `storage_server_ip`, `trim`, `idempotency_key`, `created_at`, `updated_at`) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return -1, err
 	}
@@ -52,8 +53,12 @@ func (rs *RecordingStore) CreateRecording(workspace *model.Workspace, recording
 		recording.StorageId,
 		recording.StorageServerIp,
 		recording.Trim,
+		nullableKey(recording.IdempotencyKey),
 		now,
 		now)
+	if isIdempotencyConflict(err, recording.IdempotencyKey) {
+		return -1, utils.ErrIdempotencyConflict
+	}
 	if err != nil {
 		return -1, err
 	}
@@ -90,20 +95,38 @@ Output: First Value: Recording model, Second Value: error
 If success return (Recording model, nil) else (nil, err)
 */
 func (rs *RecordingStore) GetRecordingFromDB(id int) (*model.Recording, error) {
-	var apiId string
+	return rs.getRecording("id", id)
+}
+
+/*
+Input: apiId
+Todo : Get Recording with matching api_id
+Output: First Value: Recording model, Second Value: error
+If success return (Recording model, nil) else (nil, err)
+*/
+func (rs *RecordingStore) GetRecordingByAPIId(apiId string) (*model.Recording, error) {
+	return rs.getRecording("api_id", apiId)
+}
+
+func (rs *RecordingStore) getRecording(column string, value interface{}) (*model.Recording, error) {
+	record := &model.Recording{}
 	var ready int
-	var size int
-	var text string
-	row := rs.db.QueryRow("SELECT api_id, transcription_ready, transcription_text, size FROM recordings WHERE id=?", id)
+	var checksum sql.NullString
+	var location nullableLocation
+	row := rs.db.QueryRow("SELECT id, api_id, workspace_id, transcription_ready, transcription_text, size, status, uri, checksum, storage_backend, storage_region, storage_bucket FROM recordings WHERE "+column+"=?", value)
 
-	err := row.Scan(&apiId, &ready, &text, &size)
-	if err == sql.ErrNoRows {
+	err := row.Scan(&record.Id, &record.APIId, &record.WorkspaceId, &ready, &record.TranscriptionText, &record.Size, &record.Status, &record.Uri, &checksum,
+		&location.backend, &location.region, &location.bucket)
+	if err != nil {
 		return nil, err
 	}
-	if ready == 1 {
-		return &model.Recording{APIId: apiId, Id: id, TranscriptionReady: true, TranscriptionText: text, Size: size}, nil
+	record.TranscriptionReady = ready == 1
+	if !record.TranscriptionReady {
+		record.TranscriptionText = ""
 	}
-	return &model.Recording{APIId: apiId, Id: id, Size: size}, nil
+	record.Checksum = checksum.String
+	record.Location = location.get()
+	return record, nil
 }
 
 /*
@@ -114,7 +137,7 @@ If success return (size, nil) else (nil, err)
 */
 func (rs *RecordingStore) GetRecordingSpace(id int) (int, error) {
 	var bytes int
-	row := rs.db.QueryRow(`SELECT SUM(size) FROM recordings WHERE workspace_id=?`, id)
+	row := rs.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM recordings WHERE workspace_id=?`, id)
 
 	err := row.Scan(&bytes)
 	if err == sql.ErrNoRows {
@@ -127,23 +150,75 @@ func (rs *RecordingStore) GetRecordingSpace(id int) (int, error) {
 }
 
 /*
-Input: apiId, status, size, recordingId
-Todo : Update recordings with matching id
-Output: If success return nil else return err
+Input: recordingId, workspaceId, size of the file, recording storage limit of the workspace in bytes (nil is unlimited)
+Todo : Mark the recording as uploading and reserve its size. The workspace row is locked while the recordings of the
+workspace are summed, so concurrent uploads cannot both fit in the space that is left. The recording row is locked
+so only one upload of a recording runs at a time
+Output: If success return nil, if the recording is already being uploaded return ErrUploadInProgress, if the file
+does not fit return ErrRecordingStorageFull else return err
 */
-func (rs *RecordingStore) UpdateRecording(apiId string, status string, size int64, recordingId int) error {
-	now := time.Now()
-	uri := utils.CreateS3URL("recordings", apiId)
-	stmt, err := rs.db.Prepare("UPDATE `recordings` SET `status` = ?, `uri` = ?, `size` = ?, `updated_at` = ? WHERE `id` = ?")
+func (rs *RecordingStore) StartRecordingUpload(recordingId int, workspaceId int, size int64, limit *int) error {
+	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(status, uri, size, now, recordingId)
+	defer tx.Rollback()
+
+	if limit != nil {
+		var locked int
+		err = tx.QueryRow("SELECT id FROM workspaces WHERE id = ? FOR UPDATE", workspaceId).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		var used int64
+		err = tx.QueryRow("SELECT COALESCE(SUM(size), 0) FROM recordings WHERE workspace_id = ? AND id <> ?", workspaceId, recordingId).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used+size > int64(*limit) {
+			return utils.ErrRecordingStorageFull
+		}
+	}
+
+	// Locked after the workspace so concurrent uploads always take the locks in the same order
+	var status string
+	var updatedAt time.Time
+	err = tx.QueryRow("SELECT status, updated_at FROM recordings WHERE id = ? FOR UPDATE", recordingId).Scan(&status, &updatedAt)
 	if err != nil {
 		return err
 	}
-	return nil
+	if status == recording.StatusUploading && time.Since(updatedAt) < recording.UploadTimeout {
+		return utils.ErrUploadInProgress
+	}
+
+	_, err = tx.Exec("UPDATE `recordings` SET `status` = ?, `size` = ?, `upload_error` = NULL, `updated_at` = ? WHERE `id` = ?",
+		recording.StatusUploading, size, time.Now(), recordingId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Input: recordingId, attempts, upload error
+Todo : Mark the recording upload as failed, release the reserved size and keep the error for a later retry
+Output: If success return nil else return err
+*/
+func (rs *RecordingStore) FailRecordingUpload(recordingId int, attempts int, uploadErr error) error {
+	_, err := rs.db.Exec("UPDATE `recordings` SET `status` = ?, `size` = 0, `upload_attempts` = `upload_attempts` + ?, `upload_error` = ?, `updated_at` = ? WHERE `id` = ?",
+		recording.StatusUploadFailed, attempts, uploadErr.Error(), time.Now(), recordingId)
+	return err
+}
+
+/*
+Input: recordingId, uri, size, checksum, attempts, StorageLocation model
+Todo : Mark the recording as completed with the uri, storage location, size and SHA-256 checksum of the stored file
+Output: If success return nil else return err
+*/
+func (rs *RecordingStore) CompleteRecordingUpload(recordingId int, uri string, size int64, checksum string, attempts int, location model.StorageLocation) error {
+	_, err := rs.db.Exec("UPDATE `recordings` SET `status` = ?, `uri` = ?, `storage_backend` = ?, `storage_region` = ?, `storage_bucket` = ?, `size` = ?, `checksum` = ?, `upload_attempts` = `upload_attempts` + ?, `upload_error` = NULL, `updated_at` = ? WHERE `id` = ?",
+		recording.StatusCompleted, uri, location.Backend, location.Region, location.Bucket, size, checksum, attempts, time.Now(), recordingId)
+	return err
 }
 
 /*
@@ -160,3 +235,17 @@ func (rs *RecordingStore) UpdateRecordingTranscription(update *model.RecordingTr
 	defer stmt.Close()
 	return nil
 }
+
+// Storage location columns of recordings and faxes, empty for objects stored before the location was kept
+type nullableLocation struct {
+	backend sql.NullString
+	region  sql.NullString
+	bucket  sql.NullString
+}
+
+func (l *nullableLocation) get() *model.StorageLocation {
+	if !l.backend.Valid || l.backend.String == "" {
+		return nil
+	}
+	return &model.StorageLocation{Backend: l.backend.String, Region: l.region.String, Bucket: l.bucket.String}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -95,7 +96,6 @@ If success return (valid, nil) else (false, err)
 func (us *UserStore) GetWorkspaceParams(workspaceId int) (*[]model.WorkspaceParam, error) {
 	// Execute the query
 	results, err := us.db.Query("SELECT `key`, `value` FROM workspace_params WHERE `workspace_id` = ?", workspaceId)
-	defer results.Close()
 	params := []model.WorkspaceParam{}
 	if err == sql.ErrNoRows {
 		// no records setup were setup, just return empty
@@ -104,6 +104,7 @@ func (us *UserStore) GetWorkspaceParams(workspaceId int) (*[]model.WorkspacePara
 	if err != nil {
 		return nil, err
 	}
+	defer results.Close()
 
 	for results.Next() {
 		param := model.WorkspaceParam{}
@@ -322,6 +323,41 @@ func (us *UserStore) GetBYOPSTNProvider(from, to string, workspaceId int) (*mode
 	return nil, err
 }
 
+/*
+Input: db, rates
+Todo : Drop rates of providers whose answer-seizure ratio over the last hour is below ROUTING_MIN_ASR.
+Rates are kept as they are when the setting is off or every candidate would be dropped
+Output: First Value: CallRate model slice, Second Value: error
+*/
+func filterLowASRRates(db *sql.DB, rates []*model.CallRate) ([]*model.CallRate, error) {
+	minASR, err := strconv.ParseFloat(utils.Config("ROUTING_MIN_ASR"), 64)
+	if err != nil || minASR <= 0 || len(rates) < 2 {
+		return rates, nil
+	}
+	minAttempts, err := strconv.Atoi(utils.Config("ROUTING_ASR_MIN_ATTEMPTS"))
+	if err != nil || minAttempts <= 0 {
+		minAttempts = utils.DefaultASRMinAttempts
+	}
+	asr, err := queryProviderASR(db, time.Now().Add(-time.Hour), minAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*model.CallRate, 0, len(rates))
+	for _, rate := range rates {
+		value, ok := asr[rate.ProviderId]
+		if ok && value < minASR {
+			utils.Log(logrus.WarnLevel, fmt.Sprintf("skipping provider %d, ASR %.1f%% is below %.1f%%", rate.ProviderId, value, minASR))
+			continue
+		}
+		filtered = append(filtered, rate)
+	}
+	if len(filtered) == 0 {
+		return rates, nil
+	}
+	return filtered, nil
+}
+
 /*
 Input: from, to
 Todo : Get PSTNInfo with matching from, to
@@ -329,77 +365,35 @@ Output: First Value: PSTNInfo model, Second Value: error
 If success return (PSTNInfo model, nil) else return (nil, err)
 */
 func (us *UserStore) GetBestPSTNProvider(from, to string) (*model.PSTNInfo, error) {
-	// do LCR based on dial prefixes
-
-	results, err := us.db.Query(`SELECT sip_providers.id, sip_providers.dial_prefix, sip_providers.name, sip_providers_rates.rate_ref_id, sip_providers_rates.rate
-		FROM sip_providers
-		INNER JOIN sip_providers_rates ON sip_providers_rates.provider_id = sip_providers.id
-		WHERE (sip_providers.type_of_provider = 'outbound'
-		OR sip_providers.type_of_provider = 'both')
-		AND sip_providers.active = 1`)
+	// do LCR based on dial prefixes of the rate decks currently in effect
+	utils.Log(logrus.InfoLevel, "Checking non BYO..")
+	providerRates, err := queryActiveProviderRates(us.db, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]*model.CallRate, 0, len(providerRates))
+	techPrefixes := make(map[int]string)
+	for _, value := range providerRates {
+		utils.Log(logrus.InfoLevel, fmt.Sprintf("found matching route %s from provider: %s", value.rate.DialPrefix, value.name))
+		rates = append(rates, value.rate)
+		techPrefixes[value.rate.ProviderId] = value.techPrefix
+	}
+	rates, err = filterLowASRRates(us.db, rates)
 	if err != nil {
 		return nil, err
 	}
 
-	var routableProviders []*model.RoutableProvider
-	var lowestRate *float64 = nil
 	var lowestProviderId *int
 	var lowestDialPrefix *string
-	var longestMatch *int
-
-	routableProviders = make([]*model.RoutableProvider, 0)
-
-	defer results.Close()
-	for results.Next() {
-		utils.Log(logrus.InfoLevel, "Checking non BYO..")
-		var id int
-		var dialPrefix string
-		var name string
-		var rateRefId int
-		var rate float64
-		err = results.Scan(&id, &dialPrefix, &name, &rateRefId, &rate)
-		if err != nil {
-			return nil, err
-		}
-		utils.Log(logrus.InfoLevel, "Checking rate from provider: "+name)
-		results1, err := us.db.Query(`SELECT dial_prefix
-	FROM call_rates_dial_prefixes
-	WHERE call_rates_dial_prefixes.call_rate_id = ?
-	`, rateRefId)
-		if err != nil {
-			return nil, err
-		}
-		defer results1.Close()
-		// TODO check which host is best for routing
-
-		var rateDialPrefix string
-		for results1.Next() {
-			results1.Scan(&rateDialPrefix)
-			utils.Log(logrus.InfoLevel, fmt.Sprintf("checking rate dial prefix %s\r\n", rateDialPrefix))
-			full := rateDialPrefix + ".*"
-			valid, err := regexp.MatchString(full, to)
-			if err != nil {
-				return nil, err
-			}
-			if valid {
-				utils.Log(logrus.InfoLevel, "found matching route...")
-				fullLen := len(full)
-
-				if longestMatch == nil || fullLen >= *longestMatch {
-					provider := model.RoutableProvider{
-						Provider:   id,
-						Rate:       rate,
-						DialPrefix: dialPrefix}
-					routableProviders = append(routableProviders, &provider)
-				}
-				if (longestMatch == nil || fullLen >= *longestMatch) && (lowestRate == nil || rate < *lowestRate) {
-					lowestProviderId = &id
-					lowestRate = &rate
-					lowestDialPrefix = &dialPrefix
-					longestMatch = &fullLen
-				}
-			}
-		}
+	best, err := utils.LookupBestCallRate(to, model.CallTypePSTN, rates)
+	if err != nil && err != utils.ErrNoCallRate {
+		return nil, err
+	}
+	if best != nil {
+		techPrefix := techPrefixes[best.ProviderId]
+		lowestProviderId = &best.ProviderId
+		lowestDialPrefix = &techPrefix
 	}
 	if lowestProviderId != nil {
 		var number string
@@ -632,7 +626,7 @@ func (us *UserStore) GetExtensionFlowInfo(workspaceId string, extension string)
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
-	info.FreeTrialStatus = utils.CheckFreeTrialStatus(info.Plan, trialStartedTime)
+	info.FreeTrialStatus = us.getFreeTrialStatus(info.Plan, trialStartedTime)
 	return &info, nil
 }
 
@@ -668,7 +662,7 @@ func (us *UserStore) GetFlowInfo(workspaceId string, flowId string) (*model.Exte
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
-	info.FreeTrialStatus = utils.CheckFreeTrialStatus(info.Plan, trialStartedTime)
+	info.FreeTrialStatus = us.getFreeTrialStatus(info.Plan, trialStartedTime)
 	return &info, err
 }
 
@@ -719,7 +713,7 @@ func (us *UserStore) GetCodeFlowInfo(workspaceId string, code string) (*model.Co
 	if err != nil {
 		return nil, err
 	}
-	info.FreeTrialStatus = utils.CheckFreeTrialStatus(info.Plan, trialStartedTime)
+	info.FreeTrialStatus = us.getFreeTrialStatus(info.Plan, trialStartedTime)
 	info.FoundCode = true
 	return &info, nil
 }
@@ -1073,3 +1067,13 @@ func (us *UserStore) ProcessSIPTrunkCall(did string) ([]byte, error) {
 	}
 	return nil, nil
 }
+
+// Unknown plans have no trial, so they are reported as not applicable
+func (us *UserStore) getFreeTrialStatus(planName string, started time.Time) string {
+	plan, err := getPlanByName(us.db, planName)
+	if err != nil {
+		utils.Log(logrus.WarnLevel, fmt.Sprintf("Could not get plan %s for free trial status: %s", planName, err.Error()))
+		return utils.CheckFreeTrialStatus(nil, started)
+	}
+	return utils.CheckFreeTrialStatus(plan, started)
+}
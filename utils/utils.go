@@ -2,23 +2,23 @@ package utils
 
 import (
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	lineblocs "github.com/Lineblocs/go-helpers"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	logrustash "github.com/bshuster-repo/logrus-logstash-hook"
 	guuid "github.com/google/uuid"
 	logruscloudwatch "github.com/innix/logrus-cloudwatch"
@@ -38,82 +38,455 @@ func CreateAPIID(prefix string) string {
 	return prefix + "-" + id.String()
 }
 
-func LookupBestCallRate(number string, typeRate string) *model.CallRate {
-	return &model.CallRate{CallRate: 9.99}
+// Default billing scheme used when a rate does not define its own (60/60)
+const (
+	DefaultBillingIncrement = 60
+	DefaultMinimumDuration  = 60
+)
+
+// Plan of workspaces whose own plan is not defined, unless DEFAULT_PLAN names another one
+const DefaultPlan = "pay-as-you-go"
+
+// Longest call duration handed out by call authorization, in seconds
+const MaxCallDuration = 4 * 60 * 60
+
+var (
+	ErrNoCallRate            = errors.New("no call rate available for destination")
+	ErrRateDeckExists        = errors.New("a rate deck version with this effective date already exists")
+	ErrIdempotencyConflict   = errors.New("a request with this idempotency key is already being processed")
+	ErrUnknownPlan           = errors.New("plan is not defined")
+	ErrUnknownUsageType      = errors.New("usage type is not metered")
+	ErrUnknownCallStatus     = errors.New("unknown call status")
+	ErrInvalidCallTransition = errors.New("invalid call status transition")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrCapacityExceeded      = errors.New("capacity exceeded")
+	ErrAlreadyInConference   = errors.New("call is already in the conference")
+	ErrConferenceWorkspace   = errors.New("call and conference belong to different workspaces")
+	ErrConferenceFull        = errors.New("conference is full")
+	ErrRecordingStorageFull  = errors.New("recording storage limit reached")
+	ErrUploadInProgress      = errors.New("recording is already being uploaded")
+	ErrConferenceExists      = errors.New("a conference with this name already exists, update its settings instead")
+	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrSignedURLExpired      = errors.New("signed url has expired")
+)
+
+// Header set on responses refused because the workspace reached its concurrent call limit
+const HeaderCapacityExceeded = "X-Capacity-Exceeded"
+
+// Headers used to make create requests safe to retry
+const (
+	HeaderIdempotencyKey   = "Idempotency-Key"
+	HeaderIdempotentReplay = "X-Idempotent-Replay"
+)
+
+/*
+Input: echo context, key sent in the request body
+Todo : Get the idempotency key of a request, the header wins over the body field
+Output: idempotency key, empty if the request has none
+*/
+func GetIdempotencyKey(c echo.Context, field string) string {
+	key := c.Request().Header.Get(HeaderIdempotencyKey)
+	if key != "" {
+		return key
+	}
+	return field
 }
 
-func ToCents(dollars float64) int {
-	result := dollars * 100
-	return int(result)
+/*
+Input: call type
+Todo : Normalize call type to one of PSTN, SIP or WEBRTC, defaults to PSTN
+Output: normalized call type
+*/
+func NormalizeCallType(typeRate string) string {
+	if typeRate == "" {
+		return model.CallTypePSTN
+	}
+	return strings.ToUpper(typeRate)
+}
+
+/*
+Input: number
+Todo : Strip everything except digits so the number can be compared with dial prefixes
+Output: digits only number
+*/
+func NormalizeDialNumber(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
 }
 
-func CalculateTTSCosts(length int) float64 {
-	var result float64 = float64(length) * .000005
-	return result
+/*
+Input: number, call type, candidate rates
+Todo : Pick the rate with the longest matching dial prefix, cheapest rate wins on equal prefixes
+Output: If a rate matches return (CallRate model, nil) else return (nil, ErrNoCallRate)
+*/
+func LookupBestCallRate(number string, typeRate string, rates []*model.CallRate) (*model.CallRate, error) {
+	digits := NormalizeDialNumber(number)
+	typeRate = NormalizeCallType(typeRate)
+
+	var best *model.CallRate
+	for _, rate := range rates {
+		if rate.CallType != typeRate || !strings.HasPrefix(digits, rate.DialPrefix) {
+			continue
+		}
+		if best == nil ||
+			len(rate.DialPrefix) > len(best.DialPrefix) ||
+			len(rate.DialPrefix) == len(best.DialPrefix) && rate.CallRate < best.CallRate {
+			best = rate
+		}
+	}
+	if best == nil {
+		return nil, ErrNoCallRate
+	}
+	return best, nil
 }
 
-func CalculateSTTCosts(recordingLength float64) float64 {
-	// Google cloud bills .006 per 15 seconds
-	billable := recordingLength / 15
-	var result float64 = 0.006 * billable
-	return result
+/*
+Input: seconds, CallRate model
+Todo : Round call seconds up to the billing scheme of the rate, e.g. 60/60, 30/6 or 1/1.
+The first block is the minimum duration, every block after that is one billing increment
+Output: billable seconds
+*/
+func CalculateBillableSeconds(seconds float64, rate *model.CallRate) int {
+	if seconds <= 0 {
+		return 0
+	}
+	secs := int(math.Ceil(seconds))
+	if secs <= rate.MinimumDuration {
+		return rate.MinimumDuration
+	}
+	increment := rate.BillingIncrement
+	if increment <= 0 {
+		increment = DefaultBillingIncrement
+	}
+	remaining := secs - rate.MinimumDuration
+	blocks := (remaining + increment - 1) / increment
+	return rate.MinimumDuration + blocks*increment
 }
 
-func CreateS3URL(folder string, id string) string {
-	return "https://lineblocs.s3.ca-central-1.amazonaws.com/" + folder + "/" + id
+/*
+Input: billable seconds, CallRate model
+Todo : Price billable seconds at the per minute rate, never below the minimum charge of the rate
+Output: dollars
+*/
+func CalculateCallCost(billableSeconds int, rate *model.CallRate) float64 {
+	if billableSeconds <= 0 {
+		return 0
+	}
+	dollars := float64(billableSeconds) / 60 * rate.CallRate
+	if dollars < rate.MinimumCharge {
+		return rate.MinimumCharge
+	}
+	return dollars
 }
 
-func UploadS3(folder string, name string, file multipart.File) error {
-	bucket := "lineblocs"
-	key := folder + "/" + name
-	// The session the S3 Uploader will use
-	session, err := session.NewSession(&aws.Config{
-		Region: aws.String("ca-central-1")})
+// Date formats accepted in rate decks and query params
+var dateTimeFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+/*
+Input: CSV reader with prefix, country, rate, effective date columns
+Todo : Parse a carrier rate deck, a header row is skipped when present
+Output: First Value: RateDeckEntry model slice, Second Value: error
+*/
+func ParseRateDeckCSV(r io.Reader) ([]*model.RateDeckEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
 	if err != nil {
-		return fmt.Errorf("S3 session err: %s", err)
+		return nil, err
+	}
+
+	entries := make([]*model.RateDeckEntry, 0, len(records))
+	for i, record := range records {
+		if len(record) < 4 {
+			return nil, fmt.Errorf("line %d: expected prefix, country, rate and effective date", i+1)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			if i == 0 {
+				// header row
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid rate %q", i+1, record[2])
+		}
+		effectiveFrom, err := ParseDateTime(record[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid effective date %q", i+1, record[3])
+		}
+		prefix := NormalizeDialNumber(record[0])
+		if prefix == "" {
+			return nil, fmt.Errorf("line %d: invalid prefix %q", i+1, record[0])
+		}
+		entries = append(entries, &model.RateDeckEntry{
+			DialPrefix:    prefix,
+			Country:       strings.TrimSpace(record[1]),
+			Rate:          rate,
+			EffectiveFrom: effectiveFrom})
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("rate deck is empty")
 	}
+	return entries, nil
+}
 
-	// Create an uploader with the session and default options
-	uploader := s3manager.NewUploader(session)
+/*
+Input: date in RFC3339, "2006-01-02 15:04:05" or "2006-01-02" format
+Todo : Parse a date given by a client
+Output: First Value: time, Second Value: error
+*/
+func ParseDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	var err error
+	for _, format := range dateTimeFormats {
+		var t time.Time
+		t, err = time.Parse(format, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+/*
+Input: RateDeckEntry model slice
+Todo : Check a deck for duplicate prefixes and for prefixes listed twice with a different country or rate. Prefixes
+nested inside a shorter prefix of another country effective the same day are only warned about, decks do that for
+ranges like 1876 (JM) inside 1 (US). Nested prefixes of the same country are how mobile and special ranges are priced
+Output: First Value: list of problems, empty if the deck is valid, Second Value: list of warnings
+*/
+func ValidateRateDeck(entries []*model.RateDeckEntry) ([]string, []string) {
+	problems := make([]string, 0)
+	warnings := make([]string, 0)
+	seen := make(map[string]*model.RateDeckEntry)
+	for _, entry := range entries {
+		key := entry.DialPrefix + "@" + entry.EffectiveFrom.Format(time.RFC3339)
+		existing, ok := seen[key]
+		if !ok {
+			seen[key] = entry
+			continue
+		}
+		if existing.Country == entry.Country && existing.Rate == entry.Rate {
+			problems = append(problems, fmt.Sprintf("duplicate prefix %s effective %s", entry.DialPrefix, entry.EffectiveFrom.Format("2006-01-02")))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("overlapping prefix %s effective %s: %s at %g and %s at %g",
+			entry.DialPrefix, entry.EffectiveFrom.Format("2006-01-02"), existing.Country, existing.Rate, entry.Country, entry.Rate))
+	}
+
+	for _, entry := range entries {
+		if seen[entry.DialPrefix+"@"+entry.EffectiveFrom.Format(time.RFC3339)] != entry {
+			continue
+		}
+		// Only the longest enclosing prefix is reported, it is the one the nested prefix would fall back to
+		for length := len(entry.DialPrefix) - 1; length > 0; length-- {
+			parent, ok := seen[entry.DialPrefix[:length]+"@"+entry.EffectiveFrom.Format(time.RFC3339)]
+			if !ok {
+				continue
+			}
+			if parent.Country != entry.Country {
+				warnings = append(warnings, fmt.Sprintf("prefix %s (%s) is nested inside %s (%s) effective %s",
+					entry.DialPrefix, entry.Country, parent.DialPrefix, parent.Country, entry.EffectiveFrom.Format("2006-01-02")))
+			}
+			break
+		}
+	}
+	return problems, warnings
+}
 
-	// Upload the file to S3.
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   file,
+/*
+Input: providerId, name, RateDeckEntry model slice
+Todo : Split a deck into one version per effective date. Every version holds the full deck as of its
+effective date, so an entry effective later replaces the older rate of the same prefix
+Output: RateDeck model slice ordered by effective date
+*/
+func BuildRateDeckVersions(providerId int, name string, entries []*model.RateDeckEntry) []*model.RateDeck {
+	dates := make([]time.Time, 0)
+	seenDates := make(map[time.Time]bool)
+	for _, entry := range entries {
+		if !seenDates[entry.EffectiveFrom] {
+			seenDates[entry.EffectiveFrom] = true
+			dates = append(dates, entry.EffectiveFrom)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
 	})
-	if err != nil {
-		return fmt.Errorf("failed to upload file, %v", err)
+
+	decks := make([]*model.RateDeck, 0, len(dates))
+	for _, date := range dates {
+		current := make(map[string]*model.RateDeckEntry)
+		for _, entry := range entries {
+			if entry.EffectiveFrom.After(date) {
+				continue
+			}
+			existing, ok := current[entry.DialPrefix]
+			if !ok || entry.EffectiveFrom.After(existing.EffectiveFrom) {
+				current[entry.DialPrefix] = entry
+			}
+		}
+		deck := &model.RateDeck{ProviderId: providerId, Name: name, EffectiveFrom: date}
+		for _, entry := range current {
+			deck.Entries = append(deck.Entries, entry)
+		}
+		sort.Slice(deck.Entries, func(i, j int) bool {
+			return deck.Entries[i].DialPrefix < deck.Entries[j].DialPrefix
+		})
+		deck.EntryCount = len(deck.Entries)
+		decks = append(decks, deck)
+	}
+	return decks
+}
+
+func ToCents(dollars float64) int {
+	result := dollars * 100
+	return int(result)
+}
+
+/*
+Input: balanceCents, CallRate model
+Todo : Find the longest call the balance can pay for, aligned to the billing scheme of the rate
+Output: seconds, 0 if the balance can not pay for the first billing block
+*/
+func CalculateMaxDuration(balanceCents float64, rate *model.CallRate) int {
+	if balanceCents <= 0 {
+		return 0
+	}
+	balance := balanceCents / 100
+	if rate.MinimumCharge > balance {
+		return 0
+	}
+	if rate.CallRate <= 0 {
+		return MaxCallDuration
+	}
+
+	seconds := int(math.Floor(balance / (rate.CallRate / 60)))
+	if seconds < rate.MinimumDuration {
+		return 0
+	}
+	increment := rate.BillingIncrement
+	if increment <= 0 {
+		increment = DefaultBillingIncrement
+	}
+	seconds = rate.MinimumDuration + (seconds-rate.MinimumDuration)/increment*increment
+	if seconds > MaxCallDuration {
+		return MaxCallDuration
+	}
+	return seconds
+}
+
+// Sub-cent precision kept on debits, amounts are stored in cents with 4 decimals
+const centPrecision = 10000
+
+/*
+Input: dollars
+Todo : Convert dollars to cents without truncating fractions of a cent
+Output: cents rounded to 4 decimals
+*/
+func ToPreciseCents(dollars float64) float64 {
+	return math.Round(dollars*100*centPrecision) / centPrecision
+}
+
+/*
+Input: billing period in YYYY-MM format, empty for the current month
+Todo : Get the start and end of a monthly billing period
+Output: First Value: period start, Second Value: period end, Third Value: error
+*/
+func GetBillingPeriod(period string) (time.Time, time.Time, error) {
+	start := time.Now()
+	if period != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01", period, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q, expected YYYY-MM", period)
+		}
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+/*
+Input: usage so far in cents, period start, period end, now
+Todo : Project the usage of a running period linearly to its end, finished periods are not projected
+Output: projected usage in cents
+*/
+func ProjectPeriodUsage(cents float64, start time.Time, end time.Time, now time.Time) float64 {
+	if !now.Before(end) || !now.After(start) {
+		return cents
+	}
+	elapsed := now.Sub(start).Seconds()
+	return math.Round(cents*end.Sub(start).Seconds()/elapsed*centPrecision) / centPrecision
+}
+
+/*
+Input: workspace params, key
+Todo : Get the value of a workspace param
+Output: First Value: value, Second Value: true if the param is set
+*/
+func GetWorkspaceParam(params *[]model.WorkspaceParam, key string) (string, bool) {
+	if params == nil {
+		return "", false
+	}
+	for _, param := range *params {
+		if param.Key == key {
+			return param.Value, true
+		}
 	}
-	Log(logrus.InfoLevel, fmt.Sprintf("file uploaded to, %s\n", aws.StringValue(&result.Location)))
-	return nil
+	return "", false
 }
 
-func GetPlanRecordingLimit(workspace *model.Workspace) (int, error) {
-	if workspace.Plan == "pay-as-you-go" {
-		return 1024, nil
-	} else if workspace.Plan == "starter" {
-		return 1024 * 2, nil
-	} else if workspace.Plan == "pro" {
-		return 1024 * 32, nil
-	} else if workspace.Plan == "starter" {
-		return 1024 * 128, nil
+// Country calling codes treated as high risk when neither the workspace nor HIGH_RISK_COUNTRY_CODES lists them
+const DefaultHighRiskCountryCodes = "53,232,239,245,252,263,370,371,372,675,677,678,682,685,686,688,690,850,881,882,883,960"
+
+/*
+Input: country calling code, comma separated high risk codes
+Todo : Check whether the destination country is high risk, the default list is used when none is given
+Output: true when the country is listed
+*/
+func IsHighRiskCountry(countryCode string, highRiskCodes string) bool {
+	if strings.TrimSpace(highRiskCodes) == "" {
+		highRiskCodes = DefaultHighRiskCountryCodes
 	}
-	return 0, nil
+	for _, code := range strings.Split(highRiskCodes, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(code), "+") == countryCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Providers need this many attempts in the last hour before their ASR is used for routing
+const DefaultASRMinAttempts = 20
+
+// SIP final responses in the 2xx range mean the call was answered
+func IsSIPSuccess(status int) bool {
+	return status >= 200 && status < 300
 }
 
-func GetPlanFaxLimit(workspace *model.Workspace) (*int, error) {
-	var res *int
-	if workspace.Plan == "pay-as-you-go" {
-		*res = 100
-	} else if workspace.Plan == "starter" {
-		*res = 100
-	} else if workspace.Plan == "pro" {
-		res = nil
-	} else if workspace.Plan == "starter" {
-		res = nil
+// Provisional 1xx responses are followed by a final response and are not an attempt of their own
+func IsSIPFinal(status int) bool {
+	return status >= 200
+}
+
+/*
+Input: answered attempts, total attempts
+Todo : Compute the answer-seizure ratio
+Output: ASR in percent, 0 without attempts
+*/
+func CalculateASR(answered int, attempts int) float64 {
+	if attempts == 0 {
+		return 0
 	}
-	return res, nil
+	return float64(answered) / float64(attempts) * 100
+}
+
+// Plan limits are unlimited when nil
+func WithinPlanLimit(limit *int, value int) bool {
+	return limit == nil || value <= *limit
 }
 
 func CheckRouteMatches(from string, to string, prefix string, prepend string, match string) (bool, error) {
@@ -170,19 +543,15 @@ func GetDIDRoutedServer2(rtcOptimized bool) (*lineblocs.MediaServer, error) {
 	return result, nil
 }
 
-func CheckFreeTrialStatus(plan string, started time.Time) string {
-	if plan == "trial" {
-		now := time.Now()
-		//make configurable
-		expireDays := 10
-		expireHours := expireDays * 24
-		started.Add(time.Hour * time.Duration(expireHours))
-		if started.After(now) {
-			return "expired"
-		}
-		return "pending-expiry"
+func CheckFreeTrialStatus(plan *model.Plan, started time.Time) string {
+	if plan == nil || plan.TrialDays <= 0 {
+		return "not-applicable"
+	}
+	expires := started.Add(time.Hour * 24 * time.Duration(plan.TrialDays))
+	if time.Now().After(expires) {
+		return "expired"
 	}
-	return "not-applicable"
+	return "pending-expiry"
 }
 
 func LookupSIPAddresses(host string) (*[]net.IP, error) {
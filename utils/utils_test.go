@@ -0,0 +1,410 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"lineblocs.com/api/model"
+)
+
+func TestLookupBestCallRate(t *testing.T) {
+	rates := []*model.CallRate{
+		{DialPrefix: "1", CallType: model.CallTypePSTN, CallRate: 0.02, RateRefId: 1},
+		{DialPrefix: "1416", CallType: model.CallTypePSTN, CallRate: 0.01, RateRefId: 2},
+		{DialPrefix: "1416", CallType: model.CallTypePSTN, CallRate: 0.008, RateRefId: 3},
+		{DialPrefix: "44", CallType: model.CallTypePSTN, CallRate: 0.03, RateRefId: 4},
+		{DialPrefix: "44", CallType: model.CallTypeSIP, CallRate: 0.001, RateRefId: 5},
+	}
+	tests := []struct {
+		name     string
+		number   string
+		typeRate string
+		want     int
+		wantErr  error
+	}{
+		{"longest prefix wins", "+1 (416) 555-0100", "PSTN", 3, nil},
+		{"falls back to shorter prefix", "+12125550100", "PSTN", 1, nil},
+		{"empty type is pstn", "+442071234567", "", 4, nil},
+		{"type is case insensitive", "442071234567", "sip", 5, nil},
+		{"no matching prefix", "+33123456789", "PSTN", 0, ErrNoCallRate},
+		{"no rate for type", "+14165550100", "WEBRTC", 0, ErrNoCallRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := LookupBestCallRate(tt.number, tt.typeRate, rates)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rate.RateRefId != tt.want {
+				t.Errorf("rate ref = %d, want %d", rate.RateRefId, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateDeckCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []model.RateDeckEntry
+		wantErr bool
+	}{
+		{
+			name: "header and formatted prefixes",
+			csv:  "prefix,country,rate,effective\n+1 416,CA,0.01,2026-01-01\n44,GB, 0.03 ,2026-02-01 10:00:00\n",
+			want: []model.RateDeckEntry{
+				{DialPrefix: "1416", Country: "CA", Rate: 0.01, EffectiveFrom: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{DialPrefix: "44", Country: "GB", Rate: 0.03, EffectiveFrom: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{name: "empty", csv: "prefix,country,rate,effective\n", wantErr: true},
+		{name: "missing column", csv: "1,US,0.01\n", wantErr: true},
+		{name: "invalid rate", csv: "1,US,0.01,2026-01-01\n44,GB,abc,2026-01-01\n", wantErr: true},
+		{name: "invalid date", csv: "1,US,0.01,01/02/2026\n", wantErr: true},
+		{name: "invalid prefix", csv: "+,US,0.01,2026-01-01\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseRateDeckCSV(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, entry := range entries {
+				if *entry != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, *entry, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRateDeck(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		entries      []*model.RateDeckEntry
+		want         []string
+		wantWarnings []string
+	}{
+		{
+			name: "valid deck",
+			entries: []*model.RateDeckEntry{
+				{DialPrefix: "1", Country: "US", Rate: 0.01, EffectiveFrom: jan},
+				{DialPrefix: "1212", Country: "US", Rate: 0.02, EffectiveFrom: jan},
+				{DialPrefix: "1", Country: "US", Rate: 0.015, EffectiveFrom: feb},
+			},
+		},
+		{
+			name: "duplicate",
+			entries: []*model.RateDeckEntry{
+				{DialPrefix: "44", Country: "GB", Rate: 0.03, EffectiveFrom: jan},
+				{DialPrefix: "44", Country: "GB", Rate: 0.03, EffectiveFrom: jan},
+			},
+			want: []string{"duplicate prefix 44 effective 2026-01-01"},
+		},
+		{
+			name: "same prefix with another rate",
+			entries: []*model.RateDeckEntry{
+				{DialPrefix: "44", Country: "GB", Rate: 0.03, EffectiveFrom: jan},
+				{DialPrefix: "44", Country: "GB", Rate: 0.04, EffectiveFrom: jan},
+			},
+			want: []string{"overlapping prefix 44 effective 2026-01-01: GB at 0.03 and GB at 0.04"},
+		},
+		{
+			name: "nested prefix of another country",
+			entries: []*model.RateDeckEntry{
+				{DialPrefix: "1", Country: "US", Rate: 0.01, EffectiveFrom: jan},
+				{DialPrefix: "1876", Country: "JM", Rate: 0.12, EffectiveFrom: jan},
+				{DialPrefix: "187", Country: "US", Rate: 0.01, EffectiveFrom: jan},
+			},
+			wantWarnings: []string{"prefix 1876 (JM) is nested inside 187 (US) effective 2026-01-01"},
+		},
+		{
+			name: "nested prefix effective another day",
+			entries: []*model.RateDeckEntry{
+				{DialPrefix: "1", Country: "US", Rate: 0.01, EffectiveFrom: jan},
+				{DialPrefix: "1876", Country: "JM", Rate: 0.12, EffectiveFrom: feb},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings := ValidateRateDeck(tt.entries)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if strings.Join(warnings, "\n") != strings.Join(tt.wantWarnings, "\n") {
+				t.Errorf("warnings %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestBuildRateDeckVersions(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*model.RateDeckEntry{
+		{DialPrefix: "44", Country: "GB", Rate: 0.04, EffectiveFrom: feb},
+		{DialPrefix: "1", Country: "US", Rate: 0.01, EffectiveFrom: jan},
+		{DialPrefix: "44", Country: "GB", Rate: 0.03, EffectiveFrom: jan},
+	}
+	decks := BuildRateDeckVersions(7, "carrier", entries)
+	if len(decks) != 2 {
+		t.Fatalf("got %d versions, want 2", len(decks))
+	}
+	for i, want := range []struct {
+		from  time.Time
+		rates map[string]float64
+	}{
+		{jan, map[string]float64{"1": 0.01, "44": 0.03}},
+		{feb, map[string]float64{"1": 0.01, "44": 0.04}},
+	} {
+		deck := decks[i]
+		if !deck.EffectiveFrom.Equal(want.from) || deck.ProviderId != 7 || deck.Name != "carrier" {
+			t.Errorf("version %d = %+v", i, deck)
+		}
+		if deck.EntryCount != len(want.rates) {
+			t.Errorf("version %d has %d entries, want %d", i, deck.EntryCount, len(want.rates))
+		}
+		for _, entry := range deck.Entries {
+			if want.rates[entry.DialPrefix] != entry.Rate {
+				t.Errorf("version %d prefix %s rate = %g, want %g", i, entry.DialPrefix, entry.Rate, want.rates[entry.DialPrefix])
+			}
+		}
+	}
+}
+
+func TestCalculateBillableSeconds(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds float64
+		rate    *model.CallRate
+		want    int
+	}{
+		{"not answered", 0, &model.CallRate{MinimumDuration: 60, BillingIncrement: 60}, 0},
+		{"60/60 below minimum", 5, &model.CallRate{MinimumDuration: 60, BillingIncrement: 60}, 60},
+		{"60/60 exact minute", 60, &model.CallRate{MinimumDuration: 60, BillingIncrement: 60}, 60},
+		{"60/60 second minute", 61, &model.CallRate{MinimumDuration: 60, BillingIncrement: 60}, 120},
+		{"30/6", 31, &model.CallRate{MinimumDuration: 30, BillingIncrement: 6}, 36},
+		{"30/6 on increment", 42, &model.CallRate{MinimumDuration: 30, BillingIncrement: 6}, 42},
+		{"1/1 rounds fractions up", 12.2, &model.CallRate{MinimumDuration: 1, BillingIncrement: 1}, 13},
+		{"no increment uses default", 61, &model.CallRate{MinimumDuration: 30}, 90},
+		{"no minimum", 7, &model.CallRate{BillingIncrement: 6}, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateBillableSeconds(tt.seconds, tt.rate); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateCallCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds int
+		rate    *model.CallRate
+		want    float64
+	}{
+		{"not billed", 0, &model.CallRate{CallRate: 0.02, MinimumCharge: 0.01}, 0},
+		{"per minute", 120, &model.CallRate{CallRate: 0.02}, 0.04},
+		{"partial minute", 36, &model.CallRate{CallRate: 0.05}, 0.03},
+		{"minimum charge", 6, &model.CallRate{CallRate: 0.01, MinimumCharge: 0.005}, 0.005},
+		{"above minimum charge", 600, &model.CallRate{CallRate: 0.01, MinimumCharge: 0.005}, 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateCallCost(tt.seconds, tt.rate); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToPreciseCents(t *testing.T) {
+	tests := []struct {
+		dollars float64
+		want    float64
+	}{
+		{0, 0},
+		{0.01, 1},
+		{0.000123, 0.0123},
+		{0.0000123456, 0.0012},
+		{1.5, 150},
+	}
+	for _, tt := range tests {
+		if got := ToPreciseCents(tt.dollars); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ToPreciseCents(%g) = %g, want %g", tt.dollars, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateMaxDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance float64
+		rate    *model.CallRate
+		want    int
+	}{
+		{"no balance", 0, &model.CallRate{CallRate: 0.01, MinimumDuration: 60, BillingIncrement: 60}, 0},
+		{"whole minutes", 5, &model.CallRate{CallRate: 0.01, MinimumDuration: 60, BillingIncrement: 60}, 300},
+		{"rounded down to the increment", 5, &model.CallRate{CallRate: 0.012, MinimumDuration: 30, BillingIncrement: 6}, 246},
+		{"first block not covered", 0.5, &model.CallRate{CallRate: 0.01, MinimumDuration: 60, BillingIncrement: 60}, 0},
+		{"minimum charge not covered", 0.5, &model.CallRate{CallRate: 0.0001, MinimumCharge: 0.01, MinimumDuration: 1, BillingIncrement: 1}, 0},
+		{"free rate", 1, &model.CallRate{MinimumDuration: 60, BillingIncrement: 60}, MaxCallDuration},
+		{"capped", 100000, &model.CallRate{CallRate: 0.01, MinimumDuration: 60, BillingIncrement: 60}, MaxCallDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateMaxDuration(tt.balance, tt.rate); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithinPlanLimit(t *testing.T) {
+	limit := 2
+	tests := []struct {
+		limit *int
+		value int
+		want  bool
+	}{
+		{nil, 1000, true},
+		{&limit, 1, true},
+		{&limit, 2, true},
+		{&limit, 3, false},
+	}
+	for _, tt := range tests {
+		if got := WithinPlanLimit(tt.limit, tt.value); got != tt.want {
+			t.Errorf("WithinPlanLimit(%v, %d) = %v, want %v", tt.limit, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFreeTrialStatus(t *testing.T) {
+	trial := &model.Plan{Name: "trial", TrialDays: 10}
+	tests := []struct {
+		name    string
+		plan    *model.Plan
+		started time.Time
+		want    string
+	}{
+		{"unknown plan", nil, time.Now(), "not-applicable"},
+		{"plan without trial", &model.Plan{Name: "pro"}, time.Now(), "not-applicable"},
+		{"running trial", trial, time.Now().AddDate(0, 0, -9), "pending-expiry"},
+		{"expired trial", trial, time.Now().AddDate(0, 0, -11), "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckFreeTrialStatus(tt.plan, tt.started); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBillingPeriod(t *testing.T) {
+	start, end, err := GetBillingPeriod("2026-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !start.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)) || !end.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("got %s - %s", start, end)
+	}
+
+	start, end, err = GetBillingPeriod("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if start.After(now) || !end.After(now) || start.Day() != 1 {
+		t.Errorf("current period %s - %s does not hold %s", start, end, now)
+	}
+
+	for _, period := range []string{"2026-13", "02-2026", "2026"} {
+		if _, _, err := GetBillingPeriod(period); err == nil {
+			t.Errorf("period %q was accepted", period)
+		}
+	}
+}
+
+func TestProjectPeriodUsage(t *testing.T) {
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want float64
+	}{
+		{"half way", time.Date(2026, 4, 16, 0, 0, 0, 0, time.UTC), 200},
+		{"finished period", end, 100},
+		{"not started", start, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProjectPeriodUsage(100, start, end, tt.now); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateASR(t *testing.T) {
+	tests := []struct {
+		answered int
+		attempts int
+		want     float64
+	}{
+		{0, 0, 0},
+		{0, 10, 0},
+		{5, 20, 25},
+		{3, 3, 100},
+	}
+	for _, tt := range tests {
+		if got := CalculateASR(tt.answered, tt.attempts); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("CalculateASR(%d, %d) = %g, want %g", tt.answered, tt.attempts, got, tt.want)
+		}
+	}
+	for status, want := range map[int]bool{180: false, 200: true, 299: true, 486: false} {
+		if got := IsSIPSuccess(status); got != want {
+			t.Errorf("IsSIPSuccess(%d) = %v, want %v", status, got, want)
+		}
+	}
+	for status, want := range map[int]bool{100: false, 183: false, 200: true, 503: true} {
+		if got := IsSIPFinal(status); got != want {
+			t.Errorf("IsSIPFinal(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestIsHighRiskCountry(t *testing.T) {
+	tests := []struct {
+		code     string
+		highRisk string
+		want     bool
+	}{
+		{"53", "", true},
+		{"1", "", false},
+		{"44", "44, +234", true},
+		{"234", "44, +234", true},
+		{"53", "44,234", false},
+		{"4", "44", false},
+	}
+	for _, tt := range tests {
+		if got := IsHighRiskCountry(tt.code, tt.highRisk); got != tt.want {
+			t.Errorf("IsHighRiskCountry(%q, %q) = %v, want %v", tt.code, tt.highRisk, got, tt.want)
+		}
+	}
+}